@@ -357,6 +357,51 @@ func (m *JsonMap) SetNullTimeValue(key string, value sql.NullTime) {
 	m.setValue(key, value)
 }
 
+// TryGetJSON 把键对应的值解码到dest中，值可以是嵌套的对象、数组，也可以是JSON文本
+func (m *JsonMap) TryGetJSON(key string, dest any) error {
+	v, ok := m.dataMap[key]
+	if !ok || v == nil {
+		return models.ErrNilValue
+	}
+	var data []byte
+	switch val := v.(type) {
+	case string:
+		data = []byte(val)
+	case []byte:
+		data = val
+	default:
+		jsonData, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Errorf("TryGetJSON error, key: %s, error: %w", key, err)
+		}
+		data = jsonData
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("TryGetJSON error, key: %s, error: %w", key, err)
+	}
+	return nil
+}
+
+// TryGetJsonMap 获取嵌套的JSON对象
+func (m *JsonMap) TryGetJsonMap(key string) (*JsonMap, error) {
+	if nested, ok := m.dataMap[key].(map[string]interface{}); ok {
+		return ConvertJsonMap(nested), nil
+	}
+	dataMap := make(map[string]interface{})
+	if err := m.TryGetJSON(key, &dataMap); err != nil {
+		return nil, err
+	}
+	return ConvertJsonMap(dataMap), nil
+}
+
+func (m *JsonMap) GetJsonMap(key string) *JsonMap {
+	mapVal, err := m.TryGetJsonMap(key)
+	if err != nil {
+		panic(fmt.Sprintf("GetJsonMap error, key: %s, error: %v", key, err))
+	}
+	return mapVal
+}
+
 func (m *JsonMap) GetTimeOrDefault(key string, defaultValue time.Time) time.Time {
 	timeVal, err := m.TryGetTime(key)
 	if err != nil {
@@ -57,6 +57,8 @@ const (
 	NEStatusAccountExists  NECode = 607 // 账号已存在
 	NECodeInvalidParams    NECode = 609 // 参数无效
 	NECodeUnauthorized     NECode = 401 // 未授权
+	NECodeConflict         NECode = 409 // 请求冲突
+	NECodeTooManyRequests  NECode = 429 // 请求过于频繁
 )
 
 func NECodeMessage(lang string, code NECode) string {
@@ -73,6 +75,10 @@ func NECodeMessage(lang string, code NECode) string {
 			return "尚未登陆"
 		case NEStatusAccountExists:
 			return "账号已存在"
+		case NECodeConflict:
+			return "请求冲突"
+		case NECodeTooManyRequests:
+			return "请求过于频繁"
 		default:
 			return fmt.Sprintf("未知错误：%d", code)
 		}
@@ -88,6 +94,10 @@ func NECodeMessage(lang string, code NECode) string {
 		return "Not logged in"
 	case NEStatusAccountExists:
 		return "Account already exists"
+	case NECodeConflict:
+		return "Request conflict"
+	case NECodeTooManyRequests:
+		return "Too many requests"
 	default:
 		return fmt.Sprintf("Unknown error: %d", code)
 	}
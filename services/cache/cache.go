@@ -0,0 +1,345 @@
+// Package cache 提供按类型读写的缓存，值按 Serializer 编码后保存在Redis或进程内的LRU中：
+//
+//	articles, err := cache.New[Article](ctx, client, cache.Options{Prefix: "app:article:", TTL: time.Hour, LocalSize: 1000})
+//	article, err := articles.GetOrLoad(ctx, uid, func(ctx context.Context) (Article, error) {
+//		return loadArticle(ctx, uid)
+//	})
+//
+// 设置了LocalSize时为两级缓存，进程内的LRU位于Redis之前，写入和删除通过Redis的发布订阅通知其他进程丢弃本地的副本。
+// 通知可能在断线时丢失，本地副本最多保留LocalTTL，应当按可接受的不一致时长设置
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultPrefix    = "neutron:cache:"
+	defaultLocalTTL  = time.Minute
+	defaultLocalSize = 10000
+)
+
+// Options 缓存配置，零值字段使用默认值
+type Options struct {
+	// Prefix Redis键的前缀，不同类型的缓存应当使用不同的前缀，默认为 neutron:cache:
+	Prefix string
+	// TTL 缓存的过期时间，为0时不过期
+	TTL time.Duration
+	// Serializer 值的编码方式，默认为 JSONSerializer
+	Serializer Serializer
+	// LocalSize 本地LRU的容量，大于0时启用两级缓存；纯内存缓存为0时使用默认值10000
+	LocalSize int
+	// LocalTTL 两级缓存中本地副本的最长保留时间，默认1分钟，不超过TTL
+	LocalTTL time.Duration
+}
+
+// Cache 值类型为T的缓存，可以被多个goroutine同时使用
+type Cache[T any] struct {
+	client     redis.UniversalClient
+	prefix     string
+	ttl        time.Duration
+	serializer Serializer
+	local      *lru
+	group      singleflight.Group
+
+	// generation 收到其他进程的失效通知时加1，用于丢弃通知之前从Redis读取的旧值
+	generation atomic.Uint64
+	source     string
+	pubsub     *redis.PubSub
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// invalidation 失效通知，Source为发送者，用于忽略自己发出的通知
+type invalidation struct {
+	Source string   `json:"source"`
+	Keys   []string `json:"keys"`
+}
+
+func withDefaults(options Options) Options {
+	if options.Prefix == "" {
+		options.Prefix = defaultPrefix
+	}
+	if options.Serializer == nil {
+		options.Serializer = JSONSerializer{}
+	}
+	return options
+}
+
+// New 创建基于Redis的缓存，设置了LocalSize时订阅失效通知，订阅失败时返回错误
+func New[T any](ctx context.Context, client redis.UniversalClient, options Options) (*Cache[T], error) {
+	options = withDefaults(options)
+	c := &Cache[T]{
+		client:     client,
+		prefix:     options.Prefix,
+		ttl:        options.TTL,
+		serializer: options.Serializer,
+	}
+	if options.LocalSize <= 0 {
+		return c, nil
+	}
+	localTTL := options.LocalTTL
+	if localTTL <= 0 {
+		localTTL = defaultLocalTTL
+	}
+	if options.TTL > 0 && options.TTL < localTTL {
+		localTTL = options.TTL
+	}
+	c.local = newLRU(options.LocalSize, localTTL)
+	c.source = uuid.NewString()
+	c.pubsub = client.Subscribe(ctx, c.channel())
+	// 等待订阅确认，保证返回之后其他进程的写入都能通知到
+	if _, err := c.pubsub.Receive(ctx); err != nil {
+		_ = c.pubsub.Close()
+		return nil, fmt.Errorf("subscribe cache invalidation: %w", err)
+	}
+	c.done = make(chan struct{})
+	go c.listen()
+	return c, nil
+}
+
+// NewMemory 创建进程内的缓存，用于测试和单实例部署
+func NewMemory[T any](options Options) *Cache[T] {
+	options = withDefaults(options)
+	size := options.LocalSize
+	if size <= 0 {
+		size = defaultLocalSize
+	}
+	return &Cache[T]{
+		prefix:     options.Prefix,
+		ttl:        options.TTL,
+		serializer: options.Serializer,
+		local:      newLRU(size, options.TTL),
+	}
+}
+
+func (c *Cache[T]) key(key string) string {
+	return c.prefix + key
+}
+
+func (c *Cache[T]) channel() string {
+	return c.prefix + "invalidate"
+}
+
+func (c *Cache[T]) decode(key string, data []byte) (T, error) {
+	var value T
+	if err := c.serializer.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("decode cache %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Get 读取缓存，不存在时返回false
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	var value T
+	if c.local != nil {
+		if data, ok := c.local.get(key); ok {
+			value, err := c.decode(key, data)
+			return value, err == nil, err
+		}
+	}
+	if c.client == nil {
+		return value, false, nil
+	}
+	generation := c.generation.Load()
+	data, err := c.client.Get(ctx, c.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, fmt.Errorf("get cache %s: %w", key, err)
+	}
+	value, err = c.decode(key, data)
+	if err != nil {
+		return value, false, err
+	}
+	if c.local != nil && c.generation.Load() == generation {
+		c.local.set(key, data, 0)
+	}
+	return value, true, nil
+}
+
+// MGet 批量读取缓存，返回的map只包含存在的键
+func (c *Cache[T]) MGet(ctx context.Context, keys ...string) (map[string]T, error) {
+	result := make(map[string]T, len(keys))
+	missing := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if c.local != nil {
+			if data, ok := c.local.get(key); ok {
+				value, err := c.decode(key, data)
+				if err != nil {
+					return nil, err
+				}
+				result[key] = value
+				continue
+			}
+		}
+		missing = append(missing, key)
+	}
+	if c.client == nil || len(missing) == 0 {
+		return result, nil
+	}
+
+	generation := c.generation.Load()
+	// 使用管道逐个GET而不是MGET，集群模式下的键可能分布在不同的槽
+	cmds := make([]*redis.StringCmd, len(missing))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range missing {
+			cmds[i] = pipe.Get(ctx, c.key(key))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("mget cache: %w", err)
+	}
+	for i, key := range missing {
+		data, err := cmds[i].Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get cache %s: %w", key, err)
+		}
+		value, err := c.decode(key, data)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+		if c.local != nil && c.generation.Load() == generation {
+			c.local.set(key, data, 0)
+		}
+	}
+	return result, nil
+}
+
+// Set 写入缓存，使用配置的TTL
+func (c *Cache[T]) Set(ctx context.Context, key string, value T) error {
+	return c.SetWithTTL(ctx, key, value, c.ttl)
+}
+
+// SetWithTTL 写入缓存并指定过期时间，ttl为0时不过期
+func (c *Cache[T]) SetWithTTL(ctx context.Context, key string, value T, ttl time.Duration) error {
+	data, err := c.serializer.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode cache %s: %w", key, err)
+	}
+	if c.client != nil {
+		if err := c.client.Set(ctx, c.key(key), data, max(ttl, 0)).Err(); err != nil {
+			return fmt.Errorf("set cache %s: %w", key, err)
+		}
+	}
+	if c.local != nil {
+		c.local.set(key, data, ttl)
+	}
+	return c.publish(ctx, key)
+}
+
+// Delete 删除缓存，不存在的键会被忽略
+func (c *Cache[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if c.client != nil {
+		redisKeys := make([]string, len(keys))
+		for i, key := range keys {
+			redisKeys[i] = c.key(key)
+		}
+		// 逐个删除，集群模式下的键可能分布在不同的槽
+		_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range redisKeys {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("delete cache: %w", err)
+		}
+	}
+	if c.local != nil {
+		c.local.delete(keys...)
+	}
+	return c.publish(ctx, keys...)
+}
+
+// GetOrLoad 读取缓存，不存在时调用load并写入缓存。同一个进程内同一个键的并发请求只调用一次load，
+// load返回错误时不缓存。读取或写入缓存失败时只记录日志，仍然返回load的结果
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	value, ok, err := c.Get(ctx, key)
+	if err != nil {
+		inlogger.Logger.Warnf("cache: %v", err)
+	} else if ok {
+		return value, nil
+	}
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		loaded, err := load(ctx)
+		if err != nil {
+			return loaded, err
+		}
+		if err := c.Set(ctx, key, loaded); err != nil {
+			inlogger.Logger.Warnf("cache: %v", err)
+		}
+		return loaded, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result.(T), nil
+}
+
+// publish 通知其他进程丢弃本地副本，只有两级缓存需要通知
+func (c *Cache[T]) publish(ctx context.Context, keys ...string) error {
+	if c.pubsub == nil {
+		return nil
+	}
+	message, err := json.Marshal(invalidation{Source: c.source, Keys: keys})
+	if err != nil {
+		return fmt.Errorf("encode cache invalidation: %w", err)
+	}
+	if err := c.client.Publish(ctx, c.channel(), message).Err(); err != nil {
+		return fmt.Errorf("publish cache invalidation: %w", err)
+	}
+	return nil
+}
+
+func (c *Cache[T]) listen() {
+	defer close(c.done)
+	for message := range c.pubsub.Channel() {
+		notice := invalidation{}
+		if err := json.Unmarshal([]byte(message.Payload), &notice); err != nil {
+			inlogger.Logger.Warnf("cache: invalid invalidation message on %s: %v", message.Channel, err)
+			continue
+		}
+		if notice.Source == c.source {
+			continue
+		}
+		c.generation.Add(1)
+		c.local.delete(notice.Keys...)
+	}
+}
+
+// Close 停止接收失效通知并清空本地副本，不会关闭Redis客户端
+func (c *Cache[T]) Close() error {
+	var closeErr error
+	c.closeOnce.Do(func() {
+		if c.pubsub != nil {
+			closeErr = c.pubsub.Close()
+			<-c.done
+		}
+		if c.local != nil {
+			c.local.clear()
+		}
+	})
+	return closeErr
+}
@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type article struct {
+	Uid   string
+	Title string
+	Tags  []string
+}
+
+func TestSerializers(t *testing.T) {
+	want := article{Uid: "a1", Title: "hello", Tags: []string{"go", "redis"}}
+	for name, serializer := range map[string]Serializer{
+		"json":    JSONSerializer{},
+		"gob":     GobSerializer{},
+		"msgpack": MsgpackSerializer{},
+	} {
+		data, err := serializer.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s Marshal: %v", name, err)
+		}
+		got := article{}
+		if err := serializer.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s Unmarshal: %v", name, err)
+		}
+		if got.Uid != want.Uid || got.Title != want.Title || len(got.Tags) != 2 {
+			t.Fatalf("%s round trip = %+v", name, got)
+		}
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory[article](Options{LocalSize: 2})
+	for _, uid := range []string{"a1", "a2", "a3"} {
+		if err := c.Set(ctx, uid, article{Uid: uid}); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	// 容量为2，最早写入的a1被淘汰
+	if _, ok, _ := c.Get(ctx, "a1"); ok {
+		t.Fatalf("Get(a1) found an evicted key")
+	}
+	values, err := c.MGet(ctx, "a1", "a2", "a3")
+	if err != nil || len(values) != 2 || values["a3"].Uid != "a3" {
+		t.Fatalf("MGet() = %v, %v", values, err)
+	}
+	if err := c.Delete(ctx, "a2"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if c.local.len() != 1 {
+		t.Fatalf("local len = %d, want 1", c.local.len())
+	}
+
+	if err := c.SetWithTTL(ctx, "short", article{}, time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "short"); ok {
+		t.Fatalf("Get() returned an expired value")
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	c, err := New[article](ctx, client, Options{Prefix: "test:article:", TTL: time.Minute, Serializer: MsgpackSerializer{}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (article, error) {
+		loads.Add(1)
+		<-release
+		return article{Uid: "a1", Title: "loaded"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := c.GetOrLoad(ctx, "a1", load); err != nil || value.Title != "loaded" {
+				t.Errorf("GetOrLoad() = %+v, %v", value, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads.Load() != 1 {
+		t.Fatalf("load called %d times, want 1", loads.Load())
+	}
+	if !server.Exists("test:article:a1") || server.TTL("test:article:a1") != time.Minute {
+		t.Fatalf("loaded value was not written to redis with TTL")
+	}
+
+	failed := errors.New("boom")
+	if _, err := c.GetOrLoad(ctx, "a2", func(ctx context.Context) (article, error) {
+		return article{}, failed
+	}); !errors.Is(err, failed) {
+		t.Fatalf("GetOrLoad() error = %v, want %v", err, failed)
+	}
+	if server.Exists("test:article:a2") {
+		t.Fatalf("failed load was cached")
+	}
+}
+
+func TestTwoTierInvalidation(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	options := Options{Prefix: "test:article:", LocalSize: 10}
+	first, err := New[article](ctx, client, options)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer first.Close()
+	second, err := New[article](ctx, client, options)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer second.Close()
+
+	if err := first.Set(ctx, "a1", article{Title: "v1"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	// 等待second处理完这次写入的失效通知，之后读取的值才会保存在本地
+	waitFor(t, func() bool { return second.generation.Load() == 1 })
+	if value, ok, err := second.Get(ctx, "a1"); err != nil || !ok || value.Title != "v1" {
+		t.Fatalf("second.Get() = %+v, %v, %v", value, ok, err)
+	}
+	// 直接修改Redis，本地副本仍然生效
+	server.Set("test:article:a1", `{"Title":"direct"}`)
+	if value, _, _ := second.Get(ctx, "a1"); value.Title != "v1" {
+		t.Fatalf("second.Get() bypassed the local tier: %+v", value)
+	}
+
+	if err := first.Set(ctx, "a1", article{Title: "v2"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	waitFor(t, func() bool {
+		value, _, _ := second.Get(ctx, "a1")
+		return value.Title == "v2"
+	})
+
+	if err := first.Delete(ctx, "a1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	waitFor(t, func() bool {
+		_, ok, _ := second.Get(ctx, "a1")
+		return !ok
+	})
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
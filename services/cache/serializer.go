@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Serializer 缓存值的编码方式
+type Serializer interface {
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, value any) error
+}
+
+// JSONSerializer 使用JSON编码，可读性好，其他语言的服务也能读取，是默认的编码方式
+type JSONSerializer struct{}
+
+func (JSONSerializer) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONSerializer) Unmarshal(data []byte, value any) error {
+	return json.Unmarshal(data, value)
+}
+
+// GobSerializer 使用gob编码，能保留接口字段的具体类型，接口字段的类型需要通过 gob.Register 注册
+type GobSerializer struct{}
+
+func (GobSerializer) Marshal(value any) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (GobSerializer) Unmarshal(data []byte, value any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
+
+// MsgpackSerializer 使用MessagePack编码，比JSON更紧凑，编解码也更快
+type MsgpackSerializer struct{}
+
+func (MsgpackSerializer) Marshal(value any) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+func (MsgpackSerializer) Unmarshal(data []byte, value any) error {
+	return msgpack.Unmarshal(data, value)
+}
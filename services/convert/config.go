@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IConfigGetter 读取配置项的最小接口，config/v2.IConfigStore 满足该接口
+type IConfigGetter interface {
+	GetValue(key string) (any, error)
+}
+
+// configValue 读取配置项，配置项不存在时返回nil
+func configValue(store IConfigGetter, key string) any {
+	value, err := store.GetValue(key)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// ConfigString 读取字符串配置项并去除首尾空白，配置项不存在时返回空字符串
+func ConfigString(store IConfigGetter, key string) (string, error) {
+	value := configValue(store, key)
+	if value == nil {
+		return "", nil
+	}
+	strValue, err := ToString(value)
+	if err != nil {
+		return "", fmt.Errorf("配置项[%s]格式有误: %w", key, err)
+	}
+	return strings.TrimSpace(strValue), nil
+}
+
+// ConfigInt 读取整数配置项，配置项不存在时返回0
+func ConfigInt(store IConfigGetter, key string) (int, error) {
+	value := configValue(store, key)
+	if value == nil {
+		return 0, nil
+	}
+	intValue, err := ConvertInt(value)
+	if err != nil {
+		return 0, fmt.Errorf("配置项[%s]格式有误: %w", key, err)
+	}
+	return intValue, nil
+}
+
+// ConfigDuration 读取时长配置项，支持 5m 这样的格式或秒数，配置项不存在时返回0
+func ConfigDuration(store IConfigGetter, key string) (time.Duration, error) {
+	value := configValue(store, key)
+	if value == nil {
+		return 0, nil
+	}
+	if strValue, ok := value.(string); ok {
+		if duration, err := time.ParseDuration(strValue); err == nil {
+			return duration, nil
+		}
+	}
+	seconds, err := ToInt64(value)
+	if err != nil {
+		return 0, fmt.Errorf("配置项[%s]格式有误: %w", key, err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,42 @@
+package convert
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mapConfig map[string]any
+
+func (m mapConfig) GetValue(key string) (any, error) {
+	value, ok := m[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func TestConfigValues(t *testing.T) {
+	store := mapConfig{"NAME": " app ", "SIZE": "8", "TIMEOUT": "500ms", "IDLE": 30, "BAD": "many"}
+	if name, err := ConfigString(store, "NAME"); err != nil || name != "app" {
+		t.Errorf("ConfigString() = %q, %v", name, err)
+	}
+	if size, err := ConfigInt(store, "SIZE"); err != nil || size != 8 {
+		t.Errorf("ConfigInt() = %d, %v", size, err)
+	}
+	if timeout, err := ConfigDuration(store, "TIMEOUT"); err != nil || timeout != 500*time.Millisecond {
+		t.Errorf("ConfigDuration() = %v, %v", timeout, err)
+	}
+	if idle, err := ConfigDuration(store, "IDLE"); err != nil || idle != 30*time.Second {
+		t.Errorf("ConfigDuration() seconds = %v, %v", idle, err)
+	}
+	if missing, err := ConfigInt(store, "MISSING"); err != nil || missing != 0 {
+		t.Errorf("ConfigInt() missing = %d, %v", missing, err)
+	}
+	if _, err := ConfigInt(store, "BAD"); err == nil {
+		t.Errorf("ConfigInt() with invalid value succeeded")
+	}
+	if _, err := ConfigDuration(store, "BAD"); err == nil {
+		t.Errorf("ConfigDuration() with invalid value succeeded")
+	}
+}
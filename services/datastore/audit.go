@@ -0,0 +1,378 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditActionInsert = "insert"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// AuditOptions 审计配置
+type AuditOptions struct {
+	// TableName 保存审计记录的表，默认为 audit_logs，可以通过 CreateAuditTableFor 创建
+	TableName string
+	// Actor 从ctx中读取操作者，默认读取 WithActor 写入的值
+	Actor func(ctx context.Context) string
+}
+
+type auditor struct {
+	tableName string
+	actor     func(ctx context.Context) string
+}
+
+var (
+	auditorMap   = make(map[string]*auditor)
+	auditorMutex = sync.RWMutex{}
+)
+
+// EnableAuditFor 为数据库开启审计，之后通过Table写入的行会把修改前后的内容记录到审计表中，
+// 审计记录与数据修改在同一个事务中写入
+func EnableAuditFor(dbName string, options AuditOptions) error {
+	if options.TableName == "" {
+		options.TableName = "audit_logs"
+	}
+	if !IsValidTableName(options.TableName) {
+		return fmt.Errorf("invalid audit table name: %s", options.TableName)
+	}
+	if options.Actor == nil {
+		options.Actor = ActorFrom
+	}
+	auditorMutex.Lock()
+	defer auditorMutex.Unlock()
+	auditorMap[dbName] = &auditor{tableName: options.TableName, actor: options.Actor}
+	return nil
+}
+
+func EnableAudit(options AuditOptions) error {
+	return EnableAuditFor(DefaultName, options)
+}
+
+func DisableAuditFor(dbName string) {
+	auditorMutex.Lock()
+	defer auditorMutex.Unlock()
+	delete(auditorMap, dbName)
+}
+
+func auditorFor(dbName string) *auditor {
+	auditorMutex.RLock()
+	defer auditorMutex.RUnlock()
+	return auditorMap[dbName]
+}
+
+type actorKey struct{}
+
+// WithActor 把操作者写入ctx，配合 Table.WithContext 使用
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// AuditRecord 一条审计记录，BeforeData和AfterData为行修改前后内容的JSON，TenantId为空表示不属于任何租户
+type AuditRecord struct {
+	Pk         string    `db:"pk" json:"pk"`
+	TableName  string    `db:"table_name" json:"table_name"`
+	RowPk      string    `db:"row_pk" json:"row_pk"`
+	TenantId   string    `db:"tenant_id" json:"tenant_id"`
+	Action     string    `db:"action" json:"action"`
+	Actor      string    `db:"actor" json:"actor"`
+	BeforeData string    `db:"before_data" json:"before_data"`
+	AfterData  string    `db:"after_data" json:"after_data"`
+	CreateTime time.Time `db:"create_time" json:"create_time"`
+}
+
+func (r *AuditRecord) Before() (*DataRow, error) {
+	return auditImage(r.BeforeData)
+}
+
+func (r *AuditRecord) After() (*DataRow, error) {
+	return auditImage(r.AfterData)
+}
+
+func auditImage(data string) (*DataRow, error) {
+	if data == "" {
+		return nil, nil
+	}
+	dataMap := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(data), &dataMap); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return MapToDataRow(dataMap), nil
+}
+
+// CreateAuditTableFor 创建审计表及其索引
+func CreateAuditTableFor(dbName string) error {
+	auditor := auditorFor(dbName)
+	if auditor == nil {
+		return fmt.Errorf("audit is not enabled for database %s", dbName)
+	}
+	statements := []string{
+		fmt.Sprintf(`create table if not exists %s (
+	pk varchar(64) primary key,
+	table_name varchar(128) not null,
+	row_pk varchar(256) not null,
+	tenant_id varchar(256) not null default '',
+	action varchar(16) not null,
+	actor varchar(256) not null,
+	before_data text,
+	after_data text,
+	create_time timestamp not null
+);`, auditor.tableName),
+		fmt.Sprintf(`create index if not exists %s_row_idx on %s (table_name, row_pk, tenant_id, create_time);`,
+			auditor.tableName, auditor.tableName),
+	}
+	for _, v := range statements {
+		if _, err := NamedExecFor(dbName, v, map[string]any{}); err != nil {
+			return fmt.Errorf("CreateAuditTable: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordAudit 在事务中写入一条审计记录，用于没有经过Table的写入。before和after可以是结构体、map或DataRow，
+// 记录所属的租户从ctx中读取，参考 WithTenant
+func RecordAudit(ctx context.Context, tx *SqlxTransaction, dbName, tableName string, rowPk any,
+	action string, before, after any) error {
+	auditor := auditorFor(dbName)
+	if auditor == nil {
+		return nil
+	}
+	beforeData, err := auditData(before)
+	if err != nil {
+		return fmt.Errorf("RecordAudit before: %w", err)
+	}
+	afterData, err := auditData(after)
+	if err != nil {
+		return fmt.Errorf("RecordAudit after: %w", err)
+	}
+	tenantID, _ := TenantFrom(ctx)
+	return auditor.write(ctx, tx, tableName, rowPk, tenantID, action, beforeData, afterData)
+}
+
+func (a *auditor) write(ctx context.Context, tx *SqlxTransaction, tableName string, rowPk any, tenantID string,
+	action, beforeData, afterData string) error {
+	pk, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("uuid: %w", err)
+	}
+	sqlParams := map[string]any{
+		"pk":          pk.String(),
+		"table_name":  tableName,
+		"row_pk":      fmt.Sprint(rowPk),
+		"tenant_id":   tenantID,
+		"action":      action,
+		"actor":       a.actor(ctx),
+		"before_data": nullIfEmpty(beforeData),
+		"after_data":  nullIfEmpty(afterData),
+		"create_time": time.Now().UTC(),
+	}
+	sqlText := fmt.Sprintf(`insert into %s (pk, table_name, row_pk, tenant_id, action, actor, before_data, after_data, create_time)
+values (:pk, :table_name, :row_pk, :tenant_id, :action, :actor, :before_data, :after_data, :create_time);`, a.tableName)
+	if _, err := tx.NamedExec(sqlText, sqlParams); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+	return nil
+}
+
+func nullIfEmpty(text string) any {
+	if text == "" {
+		return nil
+	}
+	return text
+}
+
+func auditData(image any) (string, error) {
+	if image == nil {
+		return "", nil
+	}
+	var dataMap map[string]any
+	switch v := image.(type) {
+	case *DataRow:
+		if v == nil {
+			return "", nil
+		}
+		dataMap = v.InnerMap()
+	case map[string]any:
+		if v == nil {
+			return "", nil
+		}
+		dataMap = v
+	default:
+		row, err := DataRowFromStruct(image)
+		if err != nil {
+			return "", err
+		}
+		dataMap = row.InnerMap()
+	}
+	normalized := make(map[string]any, len(dataMap))
+	for k, v := range dataMap {
+		normalized[k] = normalizeText(v)
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %w", err)
+	}
+	return string(data), nil
+}
+
+// auditRow 读取当前租户中行的内容，包括已软删除的行，行不存在时返回nil
+func (t *Table[T, M]) auditRow(pk any) (map[string]any, error) {
+	sqlParams := map[string]any{"uid": pk}
+	filter, err := t.WithDeleted().scopeFilter(sqlParams)
+	if err != nil {
+		return nil, err
+	}
+	sqlText := fmt.Sprintf(`select * from %s where %s = :uid%s;`, t.TableName, conventionsOf[M]().pk,
+		andFilter(filter))
+	rows, err := t.primaryQuery(sqlText, sqlParams)
+	if err != nil {
+		return nil, fmt.Errorf("NamedQuery: %w", err)
+	}
+	defer rows.Close()
+	var rowMap map[string]any
+	for rows.Next() {
+		if rowMap != nil {
+			return nil, fmt.Errorf("audit %s: primary key %v matches more than one row", t.TableName, pk)
+		}
+		rowMap = make(map[string]any)
+		if err := rows.MapScan(rowMap); err != nil {
+			return nil, fmt.Errorf("MapScan: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return rowMap, nil
+}
+
+// auditTenant 审计记录所属的租户，跨租户写入时从行的租户列读取
+func (t *Table[T, M]) auditTenant(images ...map[string]any) string {
+	if !t.allTenants {
+		if tenantID, ok := TenantFrom(t.context()); ok {
+			return tenantID
+		}
+	}
+	if field := conventionsOf[M]().tenant; field != nil {
+		for _, image := range images {
+			if value := image[field.column]; value != nil {
+				return fmt.Sprint(normalizeText(value))
+			}
+		}
+	}
+	return ""
+}
+
+// audited 执行写入并记录审计。未开启审计时直接执行write；不在事务中时自动开启事务，
+// 保证数据修改和审计记录同时提交
+func (t *Table[T, M]) audited(action string, pk any, write func(t *Table[T, M]) error) (auditErr error) {
+	auditor := auditorFor(t.Database())
+	if auditor == nil {
+		return write(t)
+	}
+	if t.tx == nil {
+		tx, err := NewTranscationFor(t.Database())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if auditErr != nil {
+				_ = tx.Rollback()
+				return
+			}
+			auditErr = tx.Commit()
+		}()
+		return t.InTransaction(tx).audited(action, pk, write)
+	}
+
+	var before, after map[string]any
+	var err error
+	if action != AuditActionInsert {
+		if before, err = t.auditRow(pk); err != nil {
+			return fmt.Errorf("audit before: %w", err)
+		}
+	}
+	if err = write(t); err != nil {
+		return err
+	}
+	if after, err = t.auditRow(pk); err != nil {
+		return fmt.Errorf("audit after: %w", err)
+	}
+	beforeData, err := auditData(before)
+	if err != nil {
+		return fmt.Errorf("audit before: %w", err)
+	}
+	afterData, err := auditData(after)
+	if err != nil {
+		return fmt.Errorf("audit after: %w", err)
+	}
+	return auditor.write(t.context(), t.tx, t.TableName, pk, t.auditTenant(before, after), action,
+		beforeData, afterData)
+}
+
+// AuditHistoryFor 按时间顺序返回某一行的审计记录。ctx中带有租户ID时只返回该租户的记录，参考 WithTenant
+func AuditHistoryFor(ctx context.Context, dbName, tableName string, rowPk any) ([]*AuditRecord, error) {
+	tenantID, ok := TenantFrom(ctx)
+	return auditHistory(dbName, tableName, rowPk, tenantID, ok)
+}
+
+func auditHistory(dbName, tableName string, rowPk any, tenantID string, byTenant bool) ([]*AuditRecord, error) {
+	auditor := auditorFor(dbName)
+	if auditor == nil {
+		return nil, fmt.Errorf("audit is not enabled for database %s", dbName)
+	}
+	sqlParams := map[string]any{"table_name": tableName, "row_pk": fmt.Sprint(rowPk)}
+	whereText := "table_name = :table_name and row_pk = :row_pk"
+	if byTenant {
+		sqlParams["tenant_id"] = tenantID
+		whereText += " and tenant_id = :tenant_id"
+	}
+	sqlText := fmt.Sprintf(`select * from %s where %s order by create_time, pk;`, auditor.tableName, whereText)
+	rows, err := NamedQueryFor(dbName, sqlText, sqlParams)
+	if err != nil {
+		return nil, fmt.Errorf("NamedQuery: %w", err)
+	}
+	defer rows.Close()
+	records := make([]*AuditRecord, 0)
+	for rows.Next() {
+		rowMap := make(map[string]any)
+		if err := rows.MapScan(rowMap); err != nil {
+			return nil, fmt.Errorf("MapScan: %w", err)
+		}
+		record := &AuditRecord{}
+		if err := MapToDataRow(rowMap).ScanInto(record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return records, nil
+}
+
+// History 按时间顺序返回某一行的审计记录，限定在当前租户内，跨租户查询时使用 AllTenants
+func (t *Table[T, M]) History(pk any) ([]*AuditRecord, error) {
+	if !t.tenantScoped() {
+		return auditHistory(t.Database(), t.TableName, pk, "", false)
+	}
+	tenantID, err := t.tenant()
+	if err != nil {
+		return nil, err
+	}
+	return auditHistory(t.Database(), t.TableName, pk, tenantID, true)
+}
@@ -0,0 +1,131 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTableAudit(t *testing.T) {
+	dbName := "audit_sqlite"
+	initSqliteForTest(t, dbName)
+	if err := EnableAuditFor(dbName, AuditOptions{}); err != nil {
+		t.Fatalf("EnableAuditFor: %v", err)
+	}
+	t.Cleanup(func() { DisableAuditFor(dbName) })
+	if err := CreateAuditTableFor(dbName); err != nil {
+		t.Fatalf("CreateAuditTableFor: %v", err)
+	}
+
+	table := NewTable[noteSchema, noteModel]("notes", noteSchema{})
+	table.SetDatabase(dbName)
+	notes := table.WithContext(WithActor(context.Background(), "alice"))
+	if err := notes.Insert(&noteModel{Pk: "a", Title: "first", Views: 1}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := notes.Update(&noteModel{Pk: "a", Title: "second", Views: 2}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := notes.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// 回滚的事务不留下审计记录
+	tx, err := NewTranscationFor(dbName)
+	if err != nil {
+		t.Fatalf("NewTranscationFor: %v", err)
+	}
+	if err := table.InTransaction(tx).Insert(&noteModel{Pk: "b", Title: "draft"}); err != nil {
+		t.Fatalf("Insert in tx: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	history, err := table.History("a")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("History() returned %d records, want 3", len(history))
+	}
+	for i, action := range []string{AuditActionInsert, AuditActionUpdate, AuditActionDelete} {
+		if history[i].Action != action || history[i].Actor != "alice" {
+			t.Errorf("record %d = %s by %s, want %s by alice", i, history[i].Action, history[i].Actor, action)
+		}
+	}
+	before, err := history[1].Before()
+	if err != nil || before.GetString("title") != "first" {
+		t.Errorf("update before = %v, %v", before, err)
+	}
+	after, err := history[1].After()
+	if err != nil || after.GetString("title") != "second" {
+		t.Errorf("update after = %v, %v", after, err)
+	}
+	if after, _ := history[2].After(); after != nil {
+		t.Errorf("delete after = %v, want nil", after.InnerMap())
+	}
+	if rollback, err := table.History("b"); err != nil || len(rollback) != 0 {
+		t.Errorf("History(b) = %v, %v, want empty", rollback, err)
+	}
+}
+
+func TestTenantAudit(t *testing.T) {
+	dbName := "audit_tenant_sqlite"
+	initSqliteForTest(t, dbName)
+	if err := EnableAuditFor(dbName, AuditOptions{}); err != nil {
+		t.Fatalf("EnableAuditFor: %v", err)
+	}
+	t.Cleanup(func() { DisableAuditFor(dbName) })
+	if err := CreateAuditTableFor(dbName); err != nil {
+		t.Fatalf("CreateAuditTableFor: %v", err)
+	}
+	_, err := NamedExecFor(dbName, `create table tenant_notes (pk text, tenant_id text, title text,
+primary key (tenant_id, pk))`, map[string]any{})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	table := NewTable[tenantNoteSchema, tenantNoteModel]("tenant_notes", tenantNoteSchema{})
+	table.SetDatabase(dbName)
+	acmeCtx := WithTenant(context.Background(), "acme")
+	acme := table.WithContext(acmeCtx)
+	globex := table.WithContext(WithTenant(context.Background(), "globex"))
+	if err := acme.Insert(&tenantNoteModel{Pk: "a", Title: "acme secret"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := globex.Insert(&tenantNoteModel{Pk: "a", Title: "globex secret"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := globex.Update(&tenantNoteModel{Pk: "a", Title: "globex update"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	history, err := globex.History("a")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("History(globex) = %d records, %v, want 2", len(history), err)
+	}
+	for _, record := range history {
+		if record.TenantId != "globex" {
+			t.Errorf("record tenant = %q, want globex", record.TenantId)
+		}
+		for _, image := range []func() (*DataRow, error){record.Before, record.After} {
+			if row, _ := image(); row != nil && row.GetString("tenant_id") != "globex" {
+				t.Errorf("%s image belongs to tenant %s", record.Action, row.GetString("tenant_id"))
+			}
+		}
+	}
+	if before, _ := history[1].Before(); before == nil || before.GetString("title") != "globex secret" {
+		t.Errorf("update before = %v", before)
+	}
+
+	if history, err := AuditHistoryFor(acmeCtx, dbName, "tenant_notes", "a"); err != nil || len(history) != 1 {
+		t.Errorf("AuditHistoryFor(acme) = %d records, %v, want 1", len(history), err)
+	}
+	if history, err := table.AllTenants().History("a"); err != nil || len(history) != 3 {
+		t.Errorf("AllTenants().History() = %d records, %v, want 3", len(history), err)
+	}
+	if _, err := table.History("a"); !errors.Is(err, ErrTenantRequired) {
+		t.Errorf("History() without tenant = %v, want ErrTenantRequired", err)
+	}
+}
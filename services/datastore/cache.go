@@ -0,0 +1,266 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheStore 查询缓存的存储后端
+type CacheStore interface {
+	// Get 读取缓存，不存在时返回 false
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set 写入缓存，ttl为0表示不过期
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Incr 把计数器加1并返回新值，用于让某个表的查询缓存整体失效
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// MemoryCacheStore 基于go-cache的进程内缓存
+type MemoryCacheStore struct {
+	cache  *cache.Cache
+	locker sync.Mutex
+}
+
+func NewMemoryCacheStore(cleanupInterval time.Duration) *MemoryCacheStore {
+	return &MemoryCacheStore{cache: cache.New(cache.NoExpiration, cleanupInterval)}
+}
+
+func (s *MemoryCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	switch v := value.(type) {
+	case []byte:
+		return v, true, nil
+	case int64:
+		return []byte(strconv.FormatInt(v, 10)), true, nil
+	}
+	return nil, false, fmt.Errorf("unexpected cache value type %T", value)
+}
+
+func (s *MemoryCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = cache.NoExpiration
+	}
+	s.cache.Set(key, value, ttl)
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		s.cache.Delete(key)
+	}
+	return nil
+}
+
+func (s *MemoryCacheStore) Incr(ctx context.Context, key string) (int64, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if err := s.cache.Add(key, int64(1), cache.NoExpiration); err == nil {
+		return 1, nil
+	}
+	return s.cache.IncrementInt64(key, 1)
+}
+
+// RedisCacheStore 基于Redis的缓存，可在多个进程间共享，客户端可以通过 redisdb.ClientFor 获取
+type RedisCacheStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisCacheStore(client redis.Cmdable) *RedisCacheStore {
+	return &RedisCacheStore{client: client}
+}
+
+func (s *RedisCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *RedisCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *RedisCacheStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+func (s *RedisCacheStore) Incr(ctx context.Context, key string) (int64, error) {
+	return s.client.Incr(ctx, key).Result()
+}
+
+// QueryCache 读穿缓存，按表和主键缓存 Table.Get 的结果，按表、SQL语句和参数的哈希缓存 NewGetQuery 的结果。
+// 缓存键都包含表的版本号，通过Table写入时递增版本号让该表的缓存整体失效，未命中时从主库读取，
+// 与写入并发的查询即使读到旧数据也只会写入已经失效的键；绕过Table的写入只能等待TTL过期
+type QueryCache struct {
+	store  CacheStore
+	ttl    time.Duration
+	prefix string
+	group  singleflight.Group
+}
+
+func NewQueryCache(store CacheStore, ttl time.Duration) *QueryCache {
+	return &QueryCache{store: store, ttl: ttl, prefix: "neutron:datastore:"}
+}
+
+// SetPrefix 设置缓存键前缀，多个应用共用一个Redis时用于区分
+func (c *QueryCache) SetPrefix(prefix string) {
+	c.prefix = prefix
+}
+
+var (
+	queryCacheMap   = make(map[string]*QueryCache)
+	queryCacheMutex = sync.RWMutex{}
+)
+
+func init() {
+	gob.Register(time.Time{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// SetQueryCacheFor 为数据库启用查询缓存，cache为nil时关闭
+func SetQueryCacheFor(dbName string, cache *QueryCache) {
+	queryCacheMutex.Lock()
+	defer queryCacheMutex.Unlock()
+	if cache == nil {
+		delete(queryCacheMap, dbName)
+		return
+	}
+	queryCacheMap[dbName] = cache
+}
+
+func SetQueryCache(cache *QueryCache) {
+	SetQueryCacheFor(DefaultName, cache)
+}
+
+func QueryCacheFor(dbName string) *QueryCache {
+	queryCacheMutex.RLock()
+	defer queryCacheMutex.RUnlock()
+	return queryCacheMap[dbName]
+}
+
+// pkKey 主键缓存的键，包含表的版本号
+func (c *QueryCache) pkKey(ctx context.Context, dbName, tableName string, pk any) (string, error) {
+	generation, err := c.generation(ctx, dbName, tableName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s:%s:%s:pk:%v", c.prefix, dbName, tableName, generation, pk), nil
+}
+
+func (c *QueryCache) generationKey(dbName, tableName string) string {
+	return fmt.Sprintf("%s%s:%s:gen", c.prefix, dbName, tableName)
+}
+
+// generation 表的当前版本号，表被写入后旧版本号的键自然失效
+func (c *QueryCache) generation(ctx context.Context, dbName, tableName string) (string, error) {
+	generation, ok, err := c.store.Get(ctx, c.generationKey(dbName, tableName))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "0", nil
+	}
+	return string(generation), nil
+}
+
+// queryKey 查询缓存的键，包含表的版本号
+func (c *QueryCache) queryKey(ctx context.Context, dbName, tableName, query string, params map[string]any) (string, error) {
+	generation, err := c.generation(ctx, dbName, tableName)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(params))
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	hash := sha1.New()
+	hash.Write([]byte(query))
+	for _, name := range names {
+		fmt.Fprintf(hash, "\x00%s=%#v", name, params[name])
+	}
+	return fmt.Sprintf("%s%s:%s:%s:q:%s", c.prefix, dbName, tableName, generation,
+		hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// Invalidate 递增表的版本号让表的缓存失效，并删除当前版本下主键对应的缓存以尽早释放空间
+func (c *QueryCache) Invalidate(ctx context.Context, dbName, tableName string, pks ...any) error {
+	keys := make([]string, 0, len(pks))
+	for _, pk := range pks {
+		key, err := c.pkKey(ctx, dbName, tableName, pk)
+		if err != nil {
+			return fmt.Errorf("cache key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if _, err := c.store.Incr(ctx, c.generationKey(dbName, tableName)); err != nil {
+		return fmt.Errorf("cache incr: %w", err)
+	}
+	if err := c.store.Delete(ctx, keys...); err != nil {
+		return fmt.Errorf("cache delete: %w", err)
+	}
+	return nil
+}
+
+// cachedLoad 先读缓存，未命中时通过singleflight调用load，同一个键的并发请求只查询一次数据库。
+// load返回false表示结果不应缓存（例如未找到）。缓存后端出错时直接查询数据库
+func cachedLoad[V any](ctx context.Context, c *QueryCache, key string, load func() (V, bool, error)) (V, error) {
+	var value V
+	if data, ok, err := c.store.Get(ctx, key); err != nil {
+		inlogger.Logger.Warnf("query cache get %s: %v", key, err)
+	} else if ok {
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err == nil {
+			return value, nil
+		} else {
+			inlogger.Logger.Warnf("query cache decode %s: %v", key, err)
+		}
+	}
+	result, err, _ := c.group.Do(key, func() (interface{}, error) {
+		loaded, cacheable, err := load()
+		if err != nil || !cacheable {
+			return loaded, err
+		}
+		var buffer bytes.Buffer
+		if err := gob.NewEncoder(&buffer).Encode(&loaded); err != nil {
+			inlogger.Logger.Warnf("query cache encode %s: %v", key, err)
+			return loaded, nil
+		}
+		if err := c.store.Set(ctx, key, buffer.Bytes(), c.ttl); err != nil {
+			inlogger.Logger.Warnf("query cache set %s: %v", key, err)
+		}
+		return loaded, nil
+	})
+	if err != nil {
+		return value, err
+	}
+	return result.(V), nil
+}
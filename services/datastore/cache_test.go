@@ -0,0 +1,161 @@
+package datastore
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueryCache(t *testing.T) {
+	dbName := "query_cache"
+	initSqliteForTest(t, dbName)
+	SetQueryCacheFor(dbName, NewQueryCache(NewMemoryCacheStore(time.Minute), time.Minute))
+	t.Cleanup(func() { SetQueryCacheFor(dbName, nil) })
+
+	table := NewTable[noteSchema, noteModel]("notes", noteSchema{})
+	table.SetDatabase(dbName)
+	if err := table.Insert(&noteModel{Pk: "a", Title: "first", Views: 1}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if note, err := table.Get("a"); err != nil || note.Title != "first" {
+		t.Fatalf("Get() = %v, %v", note, err)
+	}
+	row, err := NewGetQueryFor(dbName, "notes", "pk = :pk", "", "", map[string]any{"pk": "a"})
+	if err != nil || row.GetString("title") != "first" {
+		t.Fatalf("NewGetQueryFor() = %v, %v", row, err)
+	}
+
+	// 绕过Table写入，缓存中仍是旧值
+	if _, err := NamedExecFor(dbName, `update notes set title = 'changed' where pk = 'a'`, map[string]any{}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if note, _ := table.Get("a"); note.Title != "first" {
+		t.Fatalf("expected cached row, got %+v", note)
+	}
+	if row, _ := NewGetQueryFor(dbName, "notes", "pk = :pk", "", "", map[string]any{"pk": "a"}); row.GetString("title") != "first" {
+		t.Fatalf("expected cached query row, got %v", row.InnerMap())
+	}
+
+	// 通过Table写入后缓存失效
+	if err := table.Update(&noteModel{Pk: "a", Title: "updated", Views: 2}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if note, _ := table.Get("a"); note.Title != "updated" {
+		t.Fatalf("expected fresh row, got %+v", note)
+	}
+	if row, _ := NewGetQueryFor(dbName, "notes", "pk = :pk", "", "", map[string]any{"pk": "a"}); row.GetString("title") != "updated" {
+		t.Fatalf("expected fresh query row, got %v", row.InnerMap())
+	}
+	if err := table.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if note, err := table.Get("a"); err != nil || note != nil {
+		t.Fatalf("Get() after delete = %v, %v", note, err)
+	}
+}
+
+func TestCachedLoadSingleflight(t *testing.T) {
+	queryCache := NewQueryCache(NewMemoryCacheStore(time.Minute), time.Minute)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cachedLoad(context.Background(), queryCache, "key", func() (string, bool, error) {
+				loads.Add(1)
+				<-release
+				return "value", true, nil
+			})
+			if err != nil || value != "value" {
+				t.Errorf("cachedLoad() = %v, %v", value, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads.Load() != 1 {
+		t.Fatalf("load called %d times, want 1", loads.Load())
+	}
+}
+
+func TestQueryCacheWithDeleted(t *testing.T) {
+	dbName := "query_cache_deleted"
+	initSqliteForTest(t, dbName)
+	SetQueryCacheFor(dbName, NewQueryCache(NewMemoryCacheStore(time.Minute), time.Minute))
+	t.Cleanup(func() { SetQueryCacheFor(dbName, nil) })
+	_, err := NamedExecFor(dbName, `create table articles (pk text primary key, title text,
+create_time datetime, update_time datetime, deleted boolean, version integer)`, map[string]any{})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	table := NewTable[articleSchema, articleModel]("articles", articleSchema{})
+	table.SetDatabase(dbName)
+	if err := table.Insert(&articleModel{Pk: "a", Title: "hello"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := table.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if article, err := table.WithDeleted().Get("a"); err != nil || article == nil {
+		t.Fatalf("WithDeleted().Get() = %v, %v", article, err)
+	}
+	if article, err := table.Get("a"); err != nil || article != nil {
+		t.Fatalf("Get() after WithDeleted().Get() = %+v, %v, want nil", article, err)
+	}
+}
+
+func TestQueryCacheConsistency(t *testing.T) {
+	dbName := "query_cache_replica"
+	initReplicaForTest(t, dbName)
+	queryCache := NewQueryCache(NewMemoryCacheStore(time.Minute), time.Minute)
+	SetQueryCacheFor(dbName, queryCache)
+	t.Cleanup(func() { SetQueryCacheFor(dbName, nil) })
+	table := NewTable[articleSchema, articleModel]("articles", articleSchema{})
+	table.SetDatabase(dbName)
+
+	// 副本没有同步新插入的行，未命中时必须从主库读取
+	article := &articleModel{Pk: "a", Title: "first"}
+	if err := table.Insert(article); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if got, err := table.Get("a"); err != nil || got == nil || got.Title != "first" {
+		t.Fatalf("Get() after Insert = %+v, %v", got, err)
+	}
+
+	// 写入之前开始的查询在写入和失效之后才把旧数据写入缓存。先清空缓存，让查询未命中
+	ctx := context.Background()
+	if err := queryCache.Invalidate(ctx, dbName, "articles", "a"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	staleKey, err := queryCache.pkKey(ctx, dbName, "articles", "a")
+	if err != nil {
+		t.Fatalf("pkKey: %v", err)
+	}
+	stale := *article
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	loaded := make(chan struct{})
+	go func() {
+		defer close(loaded)
+		_, _ = cachedLoad(ctx, queryCache, staleKey, func() (*articleModel, bool, error) {
+			close(loading)
+			<-release
+			return &stale, true, nil
+		})
+	}()
+	<-loading
+	article.Title = "second"
+	if err := table.Update(article); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	close(release)
+	<-loaded
+	if got, err := table.Get("a"); err != nil || got == nil || got.Title != "second" {
+		t.Fatalf("Get() after concurrent stale load = %+v, %v, want second", got, err)
+	}
+}
@@ -0,0 +1,203 @@
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/iancoleman/strcase"
+)
+
+// 模型字段上的 datastore 标签，用于声明由Table自动维护的列：
+//
+//	Pk         string       `db:"pk" datastore:"pk"`
+//	CreateTime time.Time    `db:"create_time" datastore:"created"`
+//	UpdateTime time.Time    `db:"update_time" datastore:"updated"`
+//	Deleted    bool         `db:"deleted" datastore:"deleted"`
+//	Version    int64        `db:"version" datastore:"version"`
+//	TenantId   string       `db:"tenant_id" datastore:"tenant"`
+//
+// created/updated 字段可以是 time.Time、sql.NullTime 或 *time.Time，
+// deleted 字段可以是bool/整数标记，也可以是 sql.NullTime/*time.Time 类型的删除时间，未删除的行该列为NULL，
+// 因此不支持不能保存NULL的 time.Time。
+// tenant 字段必须是字符串，参考 WithTenant
+const (
+	conventionTag     = "datastore"
+	conventionPk      = "pk"
+	conventionCreated = "created"
+	conventionUpdated = "updated"
+	conventionDeleted = "deleted"
+	conventionVersion = "version"
+	conventionTenant  = "tenant"
+
+	deletedParam = "neutron_not_deleted"
+	versionParam = "neutron_version"
+	tenantParam  = "neutron_tenant"
+)
+
+var ErrVersionConflict = errors.New("version conflict")
+
+type conventionField struct {
+	column string
+	index  []int
+	typ    reflect.Type
+}
+
+// isNullableTime 字段是否为可以保存NULL的时间类型
+func (f *conventionField) isNullableTime() bool {
+	return f.typ == reflect.TypeOf(sql.NullTime{}) || f.typ == reflect.TypeOf((*time.Time)(nil))
+}
+
+type tableConventions struct {
+	pk      string
+	created *conventionField
+	updated *conventionField
+	deleted *conventionField
+	version *conventionField
+	tenant  *conventionField
+}
+
+var conventionCache sync.Map
+
+func conventionsOf[M any]() *tableConventions {
+	modelType := reflect.TypeOf((*M)(nil)).Elem()
+	if cached, ok := conventionCache.Load(modelType); ok {
+		return cached.(*tableConventions)
+	}
+	conventions := &tableConventions{pk: "pk"}
+	if modelType.Kind() == reflect.Struct {
+		for i := 0; i < modelType.NumField(); i++ {
+			field := modelType.Field(i)
+			tag := field.Tag.Get(conventionTag)
+			if tag == "" {
+				continue
+			}
+			column := columnName(field)
+			convField := &conventionField{column: column, index: field.Index, typ: field.Type}
+			switch tag {
+			case conventionPk:
+				conventions.pk = column
+			case conventionCreated:
+				conventions.created = convField
+			case conventionUpdated:
+				conventions.updated = convField
+			case conventionDeleted:
+				conventions.deleted = convField
+			case conventionVersion:
+				conventions.version = convField
+			case conventionTenant:
+				conventions.tenant = convField
+			}
+		}
+	}
+	conventionCache.Store(modelType, conventions)
+	return conventions
+}
+
+// PrimaryKeyColumn 返回模型的主键列，通过 datastore:"pk" 标签声明，默认为 pk
+func PrimaryKeyColumn[M any]() string {
+	return conventionsOf[M]().pk
+}
+
+func columnName(field reflect.StructField) string {
+	if dbTag := field.Tag.Get("db"); dbTag != "" && dbTag != "-" {
+		return dbTag
+	}
+	return strcase.ToSnake(field.Name)
+}
+
+// notDeletedFilter 过滤已软删除行的条件，params用于接收条件中的参数
+func (c *tableConventions) notDeletedFilter(params map[string]any) string {
+	if c.deleted == nil {
+		return ""
+	}
+	if c.deleted.isNullableTime() {
+		return fmt.Sprintf("%s is null", c.deleted.column)
+	}
+	params[deletedParam] = reflect.Zero(c.deleted.typ).Interface()
+	return fmt.Sprintf("(%s is null or %s = :%s)", c.deleted.column, c.deleted.column, deletedParam)
+}
+
+// deletedValue 软删除时写入的值
+func (c *tableConventions) deletedValue(now time.Time) (any, error) {
+	switch c.deleted.typ.Kind() {
+	case reflect.Bool:
+		return true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return 1, nil
+	}
+	if c.deleted.isNullableTime() {
+		return now, nil
+	}
+	return nil, fmt.Errorf("unsupported deleted field type: %s", c.deleted.typ)
+}
+
+// check 检查自动维护的列的类型，不支持的类型会被静默忽略，因此在写入前报错
+func (c *tableConventions) check() error {
+	for _, field := range []*conventionField{c.created, c.updated} {
+		if field != nil && !field.isTime() {
+			return fmt.Errorf("time field %s must be time.Time, sql.NullTime or *time.Time, not %s", field.column, field.typ)
+		}
+	}
+	return c.checkDeleted()
+}
+
+// checkDeleted 检查软删除列的类型，time.Time 无法表示未删除的NULL，写入零值会导致行被当作已删除
+func (c *tableConventions) checkDeleted() error {
+	if c.deleted == nil {
+		return nil
+	}
+	if c.deleted.typ == reflect.TypeOf(time.Time{}) {
+		return fmt.Errorf("deleted field %s must be sql.NullTime or *time.Time, not time.Time", c.deleted.column)
+	}
+	_, err := c.deletedValue(time.Time{})
+	return err
+}
+
+// isTime 字段是否为 setTimeField 支持的时间类型
+func (f *conventionField) isTime() bool {
+	return f.typ == reflect.TypeOf(time.Time{}) || f.isNullableTime()
+}
+
+func setTimeField(value reflect.Value, field *conventionField, now time.Time, onlyZero bool) {
+	target := value.FieldByIndex(field.index)
+	switch current := target.Interface().(type) {
+	case time.Time:
+		if !onlyZero || current.IsZero() {
+			target.Set(reflect.ValueOf(now))
+		}
+	case sql.NullTime:
+		if !onlyZero || !current.Valid {
+			target.Set(reflect.ValueOf(sql.NullTime{Time: now, Valid: true}))
+		}
+	case *time.Time:
+		if !onlyZero || current == nil || current.IsZero() {
+			target.Set(reflect.ValueOf(&now))
+		}
+	}
+}
+
+func versionOf(value reflect.Value, field *conventionField) (int64, bool) {
+	target := value.FieldByIndex(field.index)
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return target.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(target.Uint()), true
+	}
+	return 0, false
+}
+
+func setVersion(value reflect.Value, field *conventionField, version int64) {
+	target := value.FieldByIndex(field.index)
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		target.SetInt(version)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		target.SetUint(uint64(version))
+	}
+}
@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pnnh/neutron/models"
+)
+
+type articleModel struct {
+	Pk         string    `db:"pk"`
+	Title      string    `db:"title"`
+	CreateTime time.Time `db:"create_time" datastore:"created"`
+	UpdateTime time.Time `db:"update_time" datastore:"updated"`
+	Deleted    bool      `db:"deleted" datastore:"deleted"`
+	Version    int64     `db:"version" datastore:"version"`
+}
+
+type articleSchema struct{}
+
+func (s articleSchema) GetConditions() []ModelCondition {
+	return nil
+}
+
+func TestTableConventions(t *testing.T) {
+	dbName := "sqlite_convention"
+	initSqliteForTest(t, dbName)
+	_, err := NamedExecFor(dbName, `create table articles (pk text primary key, title text,
+create_time datetime, update_time datetime, deleted boolean, version integer)`, map[string]any{})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	table := NewTable[articleSchema, articleModel]("articles", articleSchema{})
+	table.SetDatabase(dbName)
+
+	article := &articleModel{Pk: "a1", Title: "hello"}
+	if err := table.Insert(article); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if article.CreateTime.IsZero() || article.UpdateTime.IsZero() || article.Version != 1 {
+		t.Fatalf("Insert did not fill conventions: %+v", article)
+	}
+
+	stale := *article
+	article.Title = "hello again"
+	if err := table.Update(article); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if article.Version != 2 {
+		t.Errorf("Version = %d, want 2", article.Version)
+	}
+	stale.Title = "lost update"
+	staleTime := stale.UpdateTime
+	if err := table.Update(&stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale Update error = %v, want ErrVersionConflict", err)
+	}
+	if !stale.UpdateTime.Equal(staleTime) {
+		t.Errorf("failed Update changed UpdateTime from %v to %v", staleTime, stale.UpdateTime)
+	}
+
+	if err := table.Delete("a1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, err := table.Get("a1"); err != nil || got != nil {
+		t.Errorf("Get after Delete = %+v, %v, want nil", got, err)
+	}
+	if count, _ := table.Count(); count != 0 {
+		t.Errorf("Count after Delete = %d, want 0", count)
+	}
+	got, err := table.WithDeleted().Get("a1")
+	if err != nil || got == nil || !got.Deleted || got.Title != "hello again" {
+		t.Errorf("WithDeleted().Get = %+v, %v", got, err)
+	}
+	if err := table.Delete("a1"); !models.IsErrNotFound(err) {
+		t.Errorf("second Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+type memoModel struct {
+	Pk         string     `db:"pk"`
+	Title      string     `db:"title"`
+	UpdateTime *time.Time `db:"update_time" datastore:"updated"`
+	Deleted    *time.Time `db:"deleted" datastore:"deleted"`
+}
+
+type badMemoModel struct {
+	Pk      string    `db:"pk"`
+	Deleted time.Time `db:"deleted" datastore:"deleted"`
+}
+
+type badTimeMemoModel struct {
+	Pk         string `db:"pk"`
+	UpdateTime string `db:"update_time" datastore:"updated"`
+}
+
+func TestTimeDeletedConvention(t *testing.T) {
+	dbName := "sqlite_convention_time"
+	initSqliteForTest(t, dbName)
+	_, err := NamedExecFor(dbName, `create table memos (pk text primary key, title text, update_time datetime, deleted datetime)`,
+		map[string]any{})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	table := NewTable[articleSchema, memoModel]("memos", articleSchema{})
+	table.SetDatabase(dbName)
+
+	memo := &memoModel{Pk: "n1", Title: "draft"}
+	if err := table.Insert(memo); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if memo.UpdateTime == nil {
+		t.Fatalf("Insert did not fill *time.Time UpdateTime")
+	}
+	got, err := table.Get("n1")
+	if err != nil || got == nil || got.Deleted != nil || got.UpdateTime == nil {
+		t.Fatalf("Get after Insert = %+v, %v", got, err)
+	}
+	if count, _ := table.Count(); count != 1 {
+		t.Errorf("Count = %d, want 1", count)
+	}
+	if err := table.Delete("n1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, err := table.Get("n1"); err != nil || got != nil {
+		t.Errorf("Get after Delete = %+v, %v, want nil", got, err)
+	}
+	if got, err := table.WithDeleted().Get("n1"); err != nil || got == nil || got.Deleted == nil {
+		t.Errorf("WithDeleted().Get = %+v, %v", got, err)
+	}
+
+	bad := NewTable[articleSchema, badMemoModel]("memos", articleSchema{})
+	bad.SetDatabase(dbName)
+	if err := bad.Insert(&badMemoModel{Pk: "n2"}); err == nil {
+		t.Errorf("Insert with time.Time deleted field succeeded")
+	}
+	badTime := NewTable[articleSchema, badTimeMemoModel]("memos", articleSchema{})
+	badTime.SetDatabase(dbName)
+	if err := badTime.Insert(&badTimeMemoModel{Pk: "n3"}); err == nil {
+		t.Errorf("Insert with string updated field succeeded")
+	}
+	if err := badTime.Update(&badTimeMemoModel{Pk: "n1"}); err == nil {
+		t.Errorf("Update with string updated field succeeded")
+	}
+}
@@ -0,0 +1,596 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const defaultCopyBatchSize = 1000
+
+// CopySource 批量导入的数据源，Next在没有更多数据时返回io.EOF
+type CopySource interface {
+	// Columns 数据源自带的列名，未知时返回nil
+	Columns() ([]string, error)
+	Next() ([]any, error)
+}
+
+// CopyColumnsSetter 知道列名的数据源实现该接口，导入时指定了列时按指定的列和顺序生成每一行
+type CopyColumnsSetter interface {
+	SetColumns(columns []string) error
+}
+
+type CopyOptions struct {
+	// BatchSize 每处理多少行回调一次进度，默认1000
+	BatchSize int
+	// Progress 进度回调，参数为已处理的总行数，结束时总会回调一次
+	Progress func(rows int64)
+}
+
+func (o *CopyOptions) batchSize() int {
+	if o == nil || o.BatchSize <= 0 {
+		return defaultCopyBatchSize
+	}
+	return o.BatchSize
+}
+
+func (o *CopyOptions) report(rows int64) {
+	if o != nil && o.Progress != nil {
+		o.Progress(rows)
+	}
+}
+
+type sliceSource struct {
+	rows  [][]any
+	index int
+}
+
+// CopyFromSlice 以二维切片作为数据源，每个元素是一行，列顺序与导入时指定的列一致
+func CopyFromSlice(rows [][]any) CopySource {
+	return &sliceSource{rows: rows}
+}
+
+func (s *sliceSource) Columns() ([]string, error) {
+	return nil, nil
+}
+
+func (s *sliceSource) Next() ([]any, error) {
+	if s.index >= len(s.rows) {
+		return nil, io.EOF
+	}
+	row := s.rows[s.index]
+	s.index++
+	return row, nil
+}
+
+type modelSource[M any] struct {
+	models  []M
+	columns []string
+	index   int
+}
+
+// CopyFromModels 以模型切片作为数据源，列名来自db标签，规则与 ReflectColumns 相同
+func CopyFromModels[M any](models []M) CopySource {
+	return &modelSource[M]{models: models}
+}
+
+func (s *modelSource[M]) Columns() ([]string, error) {
+	if s.columns != nil || len(s.models) == 0 {
+		return s.columns, nil
+	}
+	columns, err := ReflectColumns(s.models[0])
+	if err != nil {
+		return nil, fmt.Errorf("ReflectColumns: %w", err)
+	}
+	s.columns = sortedColumns(columns)
+	return s.columns, nil
+}
+
+func (s *modelSource[M]) SetColumns(columns []string) error {
+	s.columns = columns
+	return nil
+}
+
+func (s *modelSource[M]) Next() ([]any, error) {
+	if s.index >= len(s.models) {
+		return nil, io.EOF
+	}
+	columns, err := s.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values, err := ReflectColumns(s.models[s.index])
+	if err != nil {
+		return nil, fmt.Errorf("ReflectColumns: %w", err)
+	}
+	s.index++
+	row := make([]any, 0, len(columns))
+	for _, name := range columns {
+		value, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("column %s not found in model", name)
+		}
+		row = append(row, value)
+	}
+	return row, nil
+}
+
+type channelSource struct {
+	ch <-chan []any
+}
+
+// CopyFromChannel 以通道作为数据源，通道关闭时导入结束
+func CopyFromChannel(ch <-chan []any) CopySource {
+	return &channelSource{ch: ch}
+}
+
+func (s *channelSource) Columns() ([]string, error) {
+	return nil, nil
+}
+
+func (s *channelSource) Next() ([]any, error) {
+	row, ok := <-s.ch
+	if !ok {
+		return nil, io.EOF
+	}
+	return row, nil
+}
+
+type csvSource struct {
+	reader  *csv.Reader
+	header  bool
+	columns []string
+	started bool
+	// indexes 指定列在每条记录中的位置，为nil时按记录原来的顺序
+	indexes []int
+}
+
+// CopyFromCSV 以CSV作为数据源，header为true时第一行作为列名。与PostgreSQL的CSV格式一致，空字段作为NULL导入
+func CopyFromCSV(r io.Reader, header bool) CopySource {
+	reader := csv.NewReader(r)
+	return &csvSource{reader: reader, header: header}
+}
+
+func (s *csvSource) Columns() ([]string, error) {
+	if !s.header || s.started {
+		return s.columns, nil
+	}
+	s.started = true
+	record, err := s.reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	s.columns = record
+	return s.columns, nil
+}
+
+// SetColumns 按表头中的列名选择和排列字段，没有表头时字段按位置对应指定的列
+func (s *csvSource) SetColumns(columns []string) error {
+	header, err := s.Columns()
+	if err != nil || header == nil {
+		return err
+	}
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[name] = i
+	}
+	s.indexes = make([]int, 0, len(columns))
+	for _, name := range columns {
+		index, ok := positions[name]
+		if !ok {
+			return fmt.Errorf("column %s not found in csv header", name)
+		}
+		s.indexes = append(s.indexes, index)
+	}
+	return nil
+}
+
+func (s *csvSource) Next() ([]any, error) {
+	if _, err := s.Columns(); err != nil {
+		return nil, err
+	}
+	record, err := s.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("read csv: %w", err)
+	}
+	if s.indexes != nil {
+		selected := make([]string, 0, len(s.indexes))
+		for _, index := range s.indexes {
+			if index >= len(record) {
+				return nil, fmt.Errorf("csv record has %d fields, column %s is missing", len(record), s.columns[index])
+			}
+			selected = append(selected, record[index])
+		}
+		record = selected
+	}
+	row := make([]any, 0, len(record))
+	for _, v := range record {
+		if v == "" {
+			row = append(row, nil)
+		} else {
+			row = append(row, v)
+		}
+	}
+	return row, nil
+}
+
+type jsonLinesSource struct {
+	scanner *bufio.Scanner
+	columns []string
+	pending map[string]any
+}
+
+// CopyFromJSONLines 以每行一个JSON对象的数据作为数据源，未指定列时使用第一个对象的键（按字母排序）
+func CopyFromJSONLines(r io.Reader, columns []string) CopySource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &jsonLinesSource{scanner: scanner, columns: columns}
+}
+
+func (s *jsonLinesSource) readObject() (map[string]any, error) {
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			continue
+		}
+		object := make(map[string]any)
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil, fmt.Errorf("decode json line: %w", err)
+		}
+		return object, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read json lines: %w", err)
+	}
+	return nil, io.EOF
+}
+
+func (s *jsonLinesSource) Columns() ([]string, error) {
+	if s.columns != nil {
+		return s.columns, nil
+	}
+	object, err := s.readObject()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.pending = object
+	s.columns = sortedColumns(object)
+	return s.columns, nil
+}
+
+func (s *jsonLinesSource) SetColumns(columns []string) error {
+	s.columns = columns
+	return nil
+}
+
+func (s *jsonLinesSource) Next() ([]any, error) {
+	columns, err := s.Columns()
+	if err != nil {
+		return nil, err
+	}
+	object := s.pending
+	s.pending = nil
+	if object == nil {
+		if object, err = s.readObject(); err != nil {
+			return nil, err
+		}
+	}
+	row := make([]any, 0, len(columns))
+	for _, name := range columns {
+		row = append(row, jsonLineValue(object[name]))
+	}
+	return row, nil
+}
+
+func jsonLineValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if intValue, err := v.Int64(); err == nil {
+			return intValue
+		}
+		if floatValue, err := v.Float64(); err == nil {
+			return floatValue
+		}
+		return v.String()
+	case map[string]any, []any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(data)
+	default:
+		return v
+	}
+}
+
+// CopyFromFor 批量导入数据到表中，返回导入的行数。PostgreSQL使用 COPY FROM STDIN，其他方言在事务中逐行插入
+func CopyFromFor(ctx context.Context, dbName, tableName string, columns []string, source CopySource,
+	options *CopyOptions) (int64, error) {
+	if !isValidQualifiedName(tableName) {
+		return 0, fmt.Errorf("invalid table name: %s", tableName)
+	}
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) == 0 {
+		if columns, err = source.Columns(); err != nil {
+			return 0, err
+		}
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("copy %s: columns not specified", tableName)
+	}
+	for _, v := range columns {
+		if !IsValidTableName(v) {
+			return 0, fmt.Errorf("invalid column name: %s", v)
+		}
+	}
+	if err := alignCopyColumns(source, columns); err != nil {
+		return 0, fmt.Errorf("copy %s: %w", tableName, err)
+	}
+
+	var copied int64
+	event := &QueryEvent{Operation: OperationCopyIn, Query: fmt.Sprintf("copy %s (%s) from stdin", tableName,
+		strings.Join(columns, ", "))}
+	err = observe(ctx, database, event, func(ctx context.Context) (int64, error) {
+		var copyErr error
+		copied, copyErr = copyIn(ctx, database, tableName, columns, source, options)
+		return copied, copyErr
+	})
+	return copied, err
+}
+
+func CopyFrom(ctx context.Context, tableName string, columns []string, source CopySource,
+	options *CopyOptions) (int64, error) {
+	return CopyFromFor(ctx, DefaultName, tableName, columns, source, options)
+}
+
+// alignCopyColumns 让数据源按导入的列生成行，不能调整列顺序的数据源的列必须与导入的列一致
+func alignCopyColumns(source CopySource, columns []string) error {
+	if setter, ok := source.(CopyColumnsSetter); ok {
+		return setter.SetColumns(columns)
+	}
+	sourceColumns, err := source.Columns()
+	if err != nil {
+		return err
+	}
+	if sourceColumns != nil && !slices.Equal(sourceColumns, columns) {
+		return fmt.Errorf("columns %v do not match source columns %v", columns, sourceColumns)
+	}
+	return nil
+}
+
+func copyIn(ctx context.Context, database *Database, tableName string, columns []string, source CopySource,
+	options *CopyOptions) (copied int64, copyErr error) {
+	tx, err := database.Primary().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer func() {
+		if copyErr != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var stmtText string
+	if database.Dialect().Name() == DialectPostgres {
+		if schema, table, found := strings.Cut(tableName, "."); found {
+			stmtText = pq.CopyInSchema(schema, table, columns...)
+		} else {
+			stmtText = pq.CopyIn(tableName, columns...)
+		}
+	} else {
+		placeholders := make([]string, 0, len(columns))
+		for i := range columns {
+			placeholders = append(placeholders, database.Dialect().Placeholder(i+1))
+		}
+		stmtText = fmt.Sprintf("insert into %s (%s) values (%s)", tableName, strings.Join(columns, ", "),
+			strings.Join(placeholders, ", "))
+	}
+	stmt, err := tx.PrepareContext(ctx, stmtText)
+	if err != nil {
+		return 0, fmt.Errorf("prepare: %w", err)
+	}
+
+	batchSize := int64(options.batchSize())
+	for {
+		if err := ctx.Err(); err != nil {
+			_ = stmt.Close()
+			return copied, err
+		}
+		row, err := source.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			_ = stmt.Close()
+			return copied, fmt.Errorf("row %d: %w", copied+1, err)
+		}
+		if len(row) != len(columns) {
+			_ = stmt.Close()
+			return copied, fmt.Errorf("row %d: got %d values, want %d", copied+1, len(row), len(columns))
+		}
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			_ = stmt.Close()
+			return copied, fmt.Errorf("row %d: %w", copied+1, err)
+		}
+		copied++
+		if copied%batchSize == 0 {
+			options.report(copied)
+		}
+	}
+	if database.Dialect().Name() == DialectPostgres {
+		// 不带参数的Exec用于结束COPY并发送缓冲的数据
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			_ = stmt.Close()
+			return copied, fmt.Errorf("flush copy: %w", err)
+		}
+	}
+	if err := stmt.Close(); err != nil {
+		return copied, fmt.Errorf("close stmt: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return copied, fmt.Errorf("commit: %w", err)
+	}
+	options.report(copied)
+	return copied, nil
+}
+
+type CopyFormat int
+
+const (
+	CopyFormatCSV CopyFormat = iota
+	CopyFormatJSONLines
+)
+
+// CopyToFor 把查询结果以CSV（带表头）或JSON Lines格式流式写出，返回写出的行数。
+// lib/pq 不支持 COPY TO STDOUT，因此通过流式读取查询结果实现，不会把结果整体载入内存
+func CopyToFor(ctx context.Context, dbName string, w io.Writer, format CopyFormat, options *CopyOptions,
+	query string, args ...any) (int64, error) {
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return 0, err
+	}
+	var copied int64
+	event := &QueryEvent{Operation: OperationCopyOut, Query: query, Args: args}
+	err = observe(ctx, database, event, func(ctx context.Context) (int64, error) {
+		var copyErr error
+		copied, copyErr = copyOut(ctx, database, w, format, options, query, args)
+		return copied, copyErr
+	})
+	return copied, err
+}
+
+func CopyTo(ctx context.Context, w io.Writer, format CopyFormat, options *CopyOptions,
+	query string, args ...any) (int64, error) {
+	return CopyToFor(ctx, DefaultName, w, format, options, query, args...)
+}
+
+func copyOut(ctx context.Context, database *Database, w io.Writer, format CopyFormat, options *CopyOptions,
+	query string, args []any) (copied int64, copyErr error) {
+	rows, err := database.Reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("query: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && copyErr == nil {
+			copyErr = fmt.Errorf("rows.Close: %w", closeErr)
+		}
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, fmt.Errorf("columns: %w", err)
+	}
+
+	buffered := bufio.NewWriter(w)
+	csvWriter := csv.NewWriter(buffered)
+	jsonEncoder := json.NewEncoder(buffered)
+	if format == CopyFormatCSV {
+		if err := csvWriter.Write(columns); err != nil {
+			return 0, fmt.Errorf("write csv header: %w", err)
+		}
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+	batchSize := int64(options.batchSize())
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return copied, fmt.Errorf("scan: %w", err)
+		}
+		switch format {
+		case CopyFormatCSV:
+			for i, v := range values {
+				record[i] = csvValue(v)
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return copied, fmt.Errorf("write csv: %w", err)
+			}
+		case CopyFormatJSONLines:
+			object := make(map[string]any, len(columns))
+			for i, v := range values {
+				if data, ok := v.([]byte); ok {
+					v = string(data)
+				}
+				object[columns[i]] = v
+			}
+			if err := jsonEncoder.Encode(object); err != nil {
+				return copied, fmt.Errorf("write json line: %w", err)
+			}
+		default:
+			return copied, fmt.Errorf("unsupported copy format: %d", format)
+		}
+		copied++
+		if copied%batchSize == 0 {
+			options.report(copied)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return copied, fmt.Errorf("rows error: %w", err)
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return copied, fmt.Errorf("flush csv: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return copied, fmt.Errorf("flush: %w", err)
+	}
+	options.report(copied)
+	return copied, nil
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool, int64, float64:
+		return fmt.Sprint(v)
+	}
+	if valuer, ok := value.(interface{ Value() (any, error) }); ok {
+		if inner, err := valuer.Value(); err == nil {
+			return csvValue(inner)
+		}
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil() {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func isValidQualifiedName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !IsValidTableName(part) {
+			return false
+		}
+	}
+	return true
+}
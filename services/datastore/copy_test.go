@@ -0,0 +1,108 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCopyRoundTrip(t *testing.T) {
+	dbName := "sqlite_copy"
+	initSqliteForTest(t, dbName)
+	ctx := context.Background()
+
+	var progress []int64
+	options := &CopyOptions{BatchSize: 2, Progress: func(rows int64) {
+		progress = append(progress, rows)
+	}}
+	csvText := "pk,title,views\na,first,1\nb,,2\nc,\"third, quoted\",3\n"
+	copied, err := CopyFromFor(ctx, dbName, "notes", nil, CopyFromCSV(strings.NewReader(csvText), true), options)
+	if err != nil || copied != 3 {
+		t.Fatalf("CopyFromFor(csv) = %d, %v", copied, err)
+	}
+	if len(progress) != 2 || progress[0] != 2 || progress[1] != 3 {
+		t.Errorf("progress = %v, want [2 3]", progress)
+	}
+
+	jsonText := `{"pk": "d", "title": "fourth", "views": 4}` + "\n" + `{"pk": "e", "title": "fifth", "views": 5}`
+	copied, err = CopyFromFor(ctx, dbName, "notes", nil, CopyFromJSONLines(strings.NewReader(jsonText), nil), nil)
+	if err != nil || copied != 2 {
+		t.Fatalf("CopyFromFor(jsonl) = %d, %v", copied, err)
+	}
+
+	models := []noteModel{{Pk: "f", Title: "sixth", Views: 6}}
+	if _, err = CopyFromFor(ctx, dbName, "notes", nil, CopyFromModels(models), nil); err != nil {
+		t.Fatalf("CopyFromFor(models): %v", err)
+	}
+
+	var csvOut bytes.Buffer
+	copied, err = CopyToFor(ctx, dbName, &csvOut, CopyFormatCSV, nil,
+		`select pk, title, views from notes where views <= ? order by pk`, 3)
+	if err != nil || copied != 3 {
+		t.Fatalf("CopyToFor(csv) = %d, %v", copied, err)
+	}
+	wantCSV := "pk,title,views\na,first,1\nb,,2\nc,\"third, quoted\",3\n"
+	if csvOut.String() != wantCSV {
+		t.Errorf("csv output = %q, want %q", csvOut.String(), wantCSV)
+	}
+
+	var jsonOut bytes.Buffer
+	copied, err = CopyToFor(ctx, dbName, &jsonOut, CopyFormatJSONLines, nil,
+		`select pk, views from notes where views > ? order by pk`, 4)
+	if err != nil || copied != 2 {
+		t.Fatalf("CopyToFor(jsonl) = %d, %v", copied, err)
+	}
+	wantJSON := "{\"pk\":\"e\",\"views\":5}\n{\"pk\":\"f\",\"views\":6}\n"
+	if jsonOut.String() != wantJSON {
+		t.Errorf("json output = %q, want %q", jsonOut.String(), wantJSON)
+	}
+}
+
+func TestCopyFromExplicitColumns(t *testing.T) {
+	dbName := "sqlite_copy_columns"
+	initSqliteForTest(t, dbName)
+	ctx := context.Background()
+	columns := []string{"title", "pk"}
+
+	models := []noteModel{{Pk: "a", Title: "first", Views: 1}}
+	if _, err := CopyFromFor(ctx, dbName, "notes", columns, CopyFromModels(models), nil); err != nil {
+		t.Fatalf("CopyFromFor(models): %v", err)
+	}
+	csvText := "pk,views,title\nb,2,second\n"
+	if _, err := CopyFromFor(ctx, dbName, "notes", columns, CopyFromCSV(strings.NewReader(csvText), true), nil); err != nil {
+		t.Fatalf("CopyFromFor(csv): %v", err)
+	}
+	jsonText := `{"pk": "c", "title": "third", "views": 3}`
+	if _, err := CopyFromFor(ctx, dbName, "notes", columns, CopyFromJSONLines(strings.NewReader(jsonText), nil), nil); err != nil {
+		t.Fatalf("CopyFromFor(jsonl): %v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := CopyToFor(ctx, dbName, &out, CopyFormatCSV, nil, `select pk, title, views from notes order by pk`); err != nil {
+		t.Fatalf("CopyToFor: %v", err)
+	}
+	want := "pk,title,views\na,first,\nb,second,\nc,third,\n"
+	if out.String() != want {
+		t.Errorf("copied rows = %q, want %q", out.String(), want)
+	}
+
+	if _, err := CopyFromFor(ctx, dbName, "notes", []string{"pk", "missing"},
+		CopyFromCSV(strings.NewReader(csvText), true), nil); err == nil {
+		t.Errorf("CopyFromFor() with a column missing from the csv header succeeded")
+	}
+	if _, err := CopyFromFor(ctx, dbName, "notes", columns, fixedColumnsSource{}, nil); err == nil {
+		t.Errorf("CopyFromFor() with columns different from the source succeeded")
+	}
+}
+
+// fixedColumnsSource 列顺序固定、不能按导入的列调整的数据源
+type fixedColumnsSource struct{}
+
+func (fixedColumnsSource) Columns() ([]string, error) {
+	return []string{"pk", "title"}, nil
+}
+
+func (fixedColumnsSource) Next() ([]any, error) {
+	return []any{"z", "last"}, nil
+}
@@ -1,8 +1,17 @@
 package datastore
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/pnnh/neutron/models"
 )
 
 type ModelCondition struct {
@@ -15,6 +24,9 @@ type ModelCondition struct {
 	DbOperator  string
 	Changed     bool
 	Value       any
+	// JsonOperator 和 JsonPath 用于JSONB列的条件，参考 JsonGet、JsonText、Contains 和 HasKey
+	JsonOperator string
+	JsonPath     []string
 }
 
 func (m *ModelCondition) Eq(value any) *ModelCondition {
@@ -47,10 +59,26 @@ type ITable[M any] interface {
 	GetConditions() []ModelCondition
 }
 
+// ITableStore 按主键读写模型的接口，Table实现了该接口，单元测试中可以用 datastoretest.FakeTable 替代
+type ITableStore[M any] interface {
+	Get(pk any) (*M, error)
+	Insert(model *M) error
+	Update(model *M) error
+	Delete(pk any) error
+	Select(offset, limit int) ([]M, error)
+	Count() (int64, error)
+}
+
 type Table[T ITable[M], M any] struct {
 	TableName string
 	table     T
+	dbName    string
 	//conditions []ModelCondition
+	includeDeleted bool
+	allTenants     bool
+	schemaApplied  bool
+	ctx            context.Context
+	tx             *SqlxTransaction
 }
 
 func NewTable[T ITable[M], M any](name string, schema T) Table[T, M] {
@@ -73,6 +101,105 @@ func (m *Table[T, M]) SetTable(table T) {
 	m.table = table
 }
 
+// SetDatabase 指定表所在的数据库名称，默认使用 DefaultName
+func (m *Table[T, M]) SetDatabase(dbName string) {
+	m.dbName = dbName
+}
+
+func (m *Table[T, M]) Database() string {
+	if m.dbName == "" {
+		return DefaultName
+	}
+	return m.dbName
+}
+
+func (m *Table[T, M]) dialect() (Dialect, error) {
+	return DialectFor(m.Database())
+}
+
+// WithDeleted 返回一个包含已软删除行的表副本
+func (m *Table[T, M]) WithDeleted() *Table[T, M] {
+	table := *m
+	table.includeDeleted = true
+	return &table
+}
+
+// WithContext 返回一个绑定ctx的表副本，从ctx中读取租户ID和审计所需的操作者
+func (m *Table[T, M]) WithContext(ctx context.Context) *Table[T, M] {
+	table := *m
+	table.ctx = ctx
+	return &table
+}
+
+// InTransaction 返回一个在事务tx中读写的表副本，查询缓存在事务提交后才会清理
+func (m *Table[T, M]) InTransaction(tx *SqlxTransaction) *Table[T, M] {
+	table := *m
+	table.tx = tx
+	return &table
+}
+
+func (m *Table[T, M]) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// namedQuery 执行普通的读查询，不在事务中时可以使用只读副本
+func (m *Table[T, M]) namedQuery(sqlText string, arg any) (*sqlx.Rows, error) {
+	if m.tx != nil {
+		return m.tx.NamedQuery(sqlText, arg)
+	}
+	return NamedQueryReaderFor(m.Database(), sqlText, arg)
+}
+
+// primaryQuery 在主库上查询，用于写入后需要立即读到最新数据的场景
+func (m *Table[T, M]) primaryQuery(sqlText string, arg any) (*sqlx.Rows, error) {
+	if m.tx != nil {
+		return m.tx.NamedQuery(sqlText, arg)
+	}
+	return NamedQueryFor(m.Database(), sqlText, arg)
+}
+
+func (m *Table[T, M]) namedExec(sqlText string, arg any) (sql.Result, error) {
+	if m.tx != nil {
+		return m.tx.NamedExec(sqlText, arg)
+	}
+	return NamedExecFor(m.Database(), sqlText, arg)
+}
+
+// scopeFilter 查询时自动附加的软删除和租户过滤条件，参数写入params
+func (m *Table[T, M]) scopeFilter(params map[string]any) (string, error) {
+	filters := make([]string, 0, 2)
+	if !m.includeDeleted {
+		if filter := conventionsOf[M]().notDeletedFilter(params); filter != "" {
+			filters = append(filters, filter)
+		}
+	}
+	filter, err := m.tenantFilter(params)
+	if err != nil {
+		return "", err
+	}
+	if filter != "" {
+		filters = append(filters, filter)
+	}
+	return strings.Join(filters, " and "), nil
+}
+
+func andFilter(filter string) string {
+	if filter == "" {
+		return ""
+	}
+	return " and " + filter
+}
+
+func whereFilter(filter string) string {
+	if filter == "" {
+		return ""
+	}
+	return " where " + filter
+}
+
 func NewCondition(goName, goType, dbColumn, dbType string) ModelCondition {
 	cond := &ModelCondition{
 		Name:     goName,
@@ -94,26 +221,83 @@ func (m *Table[T, M]) GetWhereConditions() []ModelCondition {
 	return conditions
 }
 
+// GetWhereParams 返回条件的参数，无法序列化为JSON的值保持原样
 func (m *Table[T, M]) GetWhereParams() map[string]any {
+	params, _ := m.whereParams()
+	return params
+}
+
+func (m *Table[T, M]) whereParams() (map[string]any, error) {
 	params := make(map[string]any, 0)
 	conditions := m.table.GetConditions()
 	for _, v := range conditions {
 		if v.Changed {
-			params[v.DbColumn] = v.Value
+			value, err := v.ParamValue()
+			if err != nil {
+				params[v.ParamName()] = v.Value
+				return params, err
+			}
+			params[v.ParamName()] = value
 		}
 	}
-	return params
+	return params, nil
 }
 
+// Get 按主键查询一行，数据库启用了查询缓存时先读缓存。WithDeleted 的查询不使用缓存，避免已删除的行被缓存后
+// 返回给普通查询
 func (t *Table[T, M]) Get(pk any) (*M, error) {
-	sqlText := fmt.Sprintf(`select * from %s where pk = :uid;`, t.TableName)
+	queryCache := QueryCacheFor(t.Database())
+	if queryCache == nil || t.tx != nil || t.includeDeleted {
+		return t.get(pk, t.namedQuery)
+	}
+	var key string
+	var err error
+	if t.tenantScoped() {
+		// 不同租户的同一主键可能对应不同的行，使用带租户ID的键
+		tenantID, tenantErr := t.tenant()
+		if tenantErr != nil {
+			return nil, tenantErr
+		}
+		sqlParams := map[string]any{"uid": pk, tenantParam: tenantID}
+		key, err = queryCache.queryKey(t.context(), t.Database(), t.TableName, "get", sqlParams)
+	} else {
+		key, err = queryCache.pkKey(t.context(), t.Database(), t.TableName, pk)
+	}
+	if err != nil {
+		inlogger.Logger.Warnf("query cache key %s: %v", t.TableName, err)
+		return t.get(pk, t.namedQuery)
+	}
+	// 写入后副本可能还没有同步，缓存的数据从主库读取
+	model, err := cachedLoad(t.context(), queryCache, key, func() (*M, bool, error) {
+		model, err := t.get(pk, t.primaryQuery)
+		return model, model != nil, err
+	})
+	if err != nil || model == nil {
+		return model, err
+	}
+	result := *model
+	return &result, nil
+}
 
+// get 通过query查询一行，query为 namedQuery 或 primaryQuery
+func (t *Table[T, M]) get(pk any, query func(sqlText string, arg any) (*sqlx.Rows, error)) (*M, error) {
+	if t.needTenantSchema() {
+		// 事务中的查询与query无关，总是使用事务所在的主库连接
+		return inTenantSchema(t, func(t *Table[T, M]) (*M, error) { return t.get(pk, t.namedQuery) })
+	}
 	sqlParams := map[string]interface{}{"uid": pk}
+	filter, err := t.scopeFilter(sqlParams)
+	if err != nil {
+		return nil, err
+	}
+	sqlText := fmt.Sprintf(`select * from %s where %s = :uid%s;`, t.TableName,
+		conventionsOf[M]().pk, andFilter(filter))
+
 	//var sqlResults []*T
 	//sqlResults := t.table.NewModels()
 	sqlResults := make([]*M, 0)
 
-	rows, err := NamedQuery(sqlText, sqlParams)
+	rows, err := query(sqlText, sqlParams)
 	if err != nil {
 		return nil, fmt.Errorf("NamedQuery: %w", err)
 	}
@@ -129,6 +313,9 @@ func (t *Table[T, M]) Get(pk any) (*M, error) {
 }
 
 func (t *Table[T, M]) GetWhere(whereFunc func(m T)) (*M, error) {
+	if t.needTenantSchema() {
+		return inTenantSchema(t, func(t *Table[T, M]) (*M, error) { return t.GetWhere(whereFunc) })
+	}
 	sqlText := fmt.Sprintf(`select * from %s`, t.TableName)
 
 	//where := t //NewTable[T, M](t.TableName)
@@ -140,24 +327,30 @@ func (t *Table[T, M]) GetWhere(whereFunc func(m T)) (*M, error) {
 	conditions := t.GetWhereConditions()
 	for _, v := range conditions {
 		if v.Changed {
-			whereText += fmt.Sprintf(`%s %s %s :%s`, v.DbCondition,
-				v.DbColumn,
-				v.DbOperator,
-				v.DbColumn)
+			whereText += fmt.Sprintf(`%s %s`, v.DbCondition, v.Expression())
 		}
 	}
+	whereParams, err := t.whereParams()
+	if err != nil {
+		return nil, fmt.Errorf("whereParams: %w", err)
+	}
+	filter, err := t.scopeFilter(whereParams)
+	if err != nil {
+		return nil, err
+	}
 	if whereText != "" {
 		firstCond := conditions[0].DbCondition
 		prefix := whereText[len(firstCond):]
-		sqlText += fmt.Sprintf(` where %s`, prefix)
+		sqlText += fmt.Sprintf(` where %s`, prefix) + andFilter(filter)
+	} else {
+		sqlText += whereFilter(filter)
 	}
-	whereParams := t.GetWhereParams()
 
 	//var sqlResults []*RoleModel
 	//sqlResults := t.table.NewModels()
 	sqlResults := make([]*M, 0)
 
-	rows, err := NamedQuery(sqlText, whereParams)
+	rows, err := t.namedQuery(sqlText, whereParams)
 	if err != nil {
 		return nil, fmt.Errorf("NamedQuery: %w", err)
 	}
@@ -173,14 +366,24 @@ func (t *Table[T, M]) GetWhere(whereFunc func(m T)) (*M, error) {
 }
 
 func (t *Table[T, M]) Select(offset, limit int) ([]M, error) {
-
-	sqlText := fmt.Sprintf(`select * from %s offset :offset limit :limit;`,
-		t.TableName)
-
+	if t.needTenantSchema() {
+		return inTenantSchema(t, func(t *Table[T, M]) ([]M, error) { return t.Select(offset, limit) })
+	}
+	dialect, err := t.dialect()
+	if err != nil {
+		return nil, fmt.Errorf("dialect: %w", err)
+	}
 	sqlParams := map[string]interface{}{"offset": offset, "limit": limit}
+	filter, err := t.scopeFilter(sqlParams)
+	if err != nil {
+		return nil, err
+	}
+	sqlText := fmt.Sprintf(`select * from %s%s%s;`, t.TableName,
+		whereFilter(filter), dialect.LimitOffset(":limit", ":offset"))
+
 	var sqlResults []M
 
-	rows, err := NamedQuery(sqlText, sqlParams)
+	rows, err := t.namedQuery(sqlText, sqlParams)
 	if err != nil {
 		return nil, fmt.Errorf("NamedQuery: %w", err)
 	}
@@ -192,14 +395,21 @@ func (t *Table[T, M]) Select(offset, limit int) ([]M, error) {
 }
 
 func (t *Table[T, M]) Count() (int64, error) {
-	sqlText := fmt.Sprintf(`select count(1) as count from %s;`, t.TableName)
-
+	if t.needTenantSchema() {
+		return inTenantSchema(t, func(t *Table[T, M]) (int64, error) { return t.Count() })
+	}
 	sqlParams := map[string]interface{}{}
+	filter, err := t.scopeFilter(sqlParams)
+	if err != nil {
+		return 0, err
+	}
+	sqlText := fmt.Sprintf(`select count(1) as count from %s%s;`, t.TableName, whereFilter(filter))
+
 	var sqlResults []struct {
 		Count int64 `db:"count"`
 	}
 
-	rows, err := NamedQuery(sqlText, sqlParams)
+	rows, err := t.namedQuery(sqlText, sqlParams)
 	if err != nil {
 		return 0, fmt.Errorf("NamedQuery: %w", err)
 	}
@@ -212,3 +422,246 @@ func (t *Table[T, M]) Count() (int64, error) {
 
 	return sqlResults[0].Count, nil
 }
+
+func sortedColumns(columns map[string]any) []string {
+	names := make([]string, 0, len(columns))
+	for k := range columns {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Insert 插入一行，自动填充创建时间、更新时间、初始版本号和租户ID
+func (t *Table[T, M]) Insert(model *M) error {
+	if t.needTenantSchema() {
+		return inTenantSchemaExec(t, func(t *Table[T, M]) error { return t.Insert(model) })
+	}
+	conventions := conventionsOf[M]()
+	if err := conventions.check(); err != nil {
+		return err
+	}
+	value := reflect.ValueOf(model).Elem()
+	if err := t.fillTenant(value); err != nil {
+		return err
+	}
+	now := time.Now()
+	if conventions.created != nil {
+		setTimeField(value, conventions.created, now, true)
+	}
+	if conventions.updated != nil {
+		setTimeField(value, conventions.updated, now, true)
+	}
+	if conventions.version != nil {
+		if version, ok := versionOf(value, conventions.version); ok && version == 0 {
+			setVersion(value, conventions.version, 1)
+		}
+	}
+	columns, err := ReflectColumns(model)
+	if err != nil {
+		return fmt.Errorf("ReflectColumns: %w", err)
+	}
+	names := sortedColumns(columns)
+	sqlText := fmt.Sprintf(`insert into %s (%s) values (:%s);`, t.TableName,
+		strings.Join(names, ", "), strings.Join(names, ", :"))
+
+	pkValue := columns[conventions.pk]
+	return t.audited(AuditActionInsert, pkValue, func(t *Table[T, M]) error {
+		if _, err := t.namedExec(sqlText, columns); err != nil {
+			return fmt.Errorf("NamedExec: %w", err)
+		}
+		t.invalidate(pkValue)
+		return nil
+	})
+}
+
+// Update 按主键更新一行，自动刷新更新时间。存在版本列时要求版本号与数据库一致，否则返回 ErrVersionConflict
+func (t *Table[T, M]) Update(model *M) (err error) {
+	if t.needTenantSchema() {
+		return inTenantSchemaExec(t, func(t *Table[T, M]) error { return t.Update(model) })
+	}
+	conventions := conventionsOf[M]()
+	if err := conventions.check(); err != nil {
+		return err
+	}
+	value := reflect.ValueOf(model).Elem()
+	if conventions.updated != nil {
+		// 更新失败时恢复调用方模型中的更新时间，避免与数据库中的行不一致
+		field := value.FieldByIndex(conventions.updated.index)
+		previous := reflect.New(field.Type()).Elem()
+		previous.Set(field)
+		defer func() {
+			if err != nil {
+				field.Set(previous)
+			}
+		}()
+		setTimeField(value, conventions.updated, time.Now(), false)
+	}
+	columns, err := ReflectColumns(model)
+	if err != nil {
+		return fmt.Errorf("ReflectColumns: %w", err)
+	}
+	pkValue, ok := columns[conventions.pk]
+	if !ok {
+		return fmt.Errorf("primary key column %s not found", conventions.pk)
+	}
+
+	skipColumns := map[string]bool{conventions.pk: true}
+	for _, v := range []*conventionField{conventions.created, conventions.deleted, conventions.version, conventions.tenant} {
+		if v != nil {
+			skipColumns[v.column] = true
+		}
+	}
+	sets := make([]string, 0, len(columns))
+	for _, name := range sortedColumns(columns) {
+		if !skipColumns[name] {
+			sets = append(sets, fmt.Sprintf("%s = :%s", name, name))
+		}
+	}
+	whereText := fmt.Sprintf("%s = :%s", conventions.pk, conventions.pk)
+	var currentVersion int64
+	if conventions.version != nil {
+		currentVersion, _ = versionOf(value, conventions.version)
+		sets = append(sets, fmt.Sprintf("%s = %s + 1", conventions.version.column, conventions.version.column))
+		whereText += fmt.Sprintf(" and %s = :%s", conventions.version.column, versionParam)
+		columns[versionParam] = currentVersion
+	}
+	filter, err := t.scopeFilter(columns)
+	if err != nil {
+		return err
+	}
+	whereText += andFilter(filter)
+	sqlText := fmt.Sprintf(`update %s set %s where %s;`, t.TableName, strings.Join(sets, ", "), whereText)
+
+	err = t.audited(AuditActionUpdate, pkValue, func(t *Table[T, M]) error {
+		result, err := t.namedExec(sqlText, columns)
+		if err != nil {
+			return fmt.Errorf("NamedExec: %w", err)
+		}
+		t.invalidate(pkValue)
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			if conventions.version == nil {
+				return models.ErrNotFound
+			}
+			exists, err := t.exists(pkValue)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return ErrVersionConflict
+			}
+			return models.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if conventions.version != nil {
+		setVersion(value, conventions.version, currentVersion+1)
+	}
+	return nil
+}
+
+// Delete 按主键删除一行，存在软删除列时只做标记
+func (t *Table[T, M]) Delete(pk any) error {
+	if t.needTenantSchema() {
+		return inTenantSchemaExec(t, func(t *Table[T, M]) error { return t.Delete(pk) })
+	}
+	conventions := conventionsOf[M]()
+	if conventions.deleted == nil {
+		return t.HardDelete(pk)
+	}
+	now := time.Now()
+	deletedValue, err := conventions.deletedValue(now)
+	if err != nil {
+		return err
+	}
+	sqlParams := map[string]any{"uid": pk, "neutron_deleted": deletedValue}
+	sets := []string{fmt.Sprintf("%s = :neutron_deleted", conventions.deleted.column)}
+	if conventions.updated != nil {
+		sqlParams["neutron_updated"] = now
+		sets = append(sets, fmt.Sprintf("%s = :neutron_updated", conventions.updated.column))
+	}
+	if conventions.version != nil {
+		sets = append(sets, fmt.Sprintf("%s = %s + 1", conventions.version.column, conventions.version.column))
+	}
+	tenantFilter, err := t.tenantFilter(sqlParams)
+	if err != nil {
+		return err
+	}
+	sqlText := fmt.Sprintf(`update %s set %s where %s = :uid%s%s;`, t.TableName, strings.Join(sets, ", "),
+		conventions.pk, andFilter(conventions.notDeletedFilter(sqlParams)), andFilter(tenantFilter))
+	return t.audited(AuditActionDelete, pk, func(t *Table[T, M]) error {
+		defer t.invalidate(pk)
+		return t.execAffected(sqlText, sqlParams)
+	})
+}
+
+// HardDelete 按主键物理删除一行
+func (t *Table[T, M]) HardDelete(pk any) error {
+	if t.needTenantSchema() {
+		return inTenantSchemaExec(t, func(t *Table[T, M]) error { return t.HardDelete(pk) })
+	}
+	sqlParams := map[string]any{"uid": pk}
+	tenantFilter, err := t.tenantFilter(sqlParams)
+	if err != nil {
+		return err
+	}
+	sqlText := fmt.Sprintf(`delete from %s where %s = :uid%s;`, t.TableName, conventionsOf[M]().pk,
+		andFilter(tenantFilter))
+	return t.audited(AuditActionDelete, pk, func(t *Table[T, M]) error {
+		defer t.invalidate(pk)
+		return t.execAffected(sqlText, sqlParams)
+	})
+}
+
+// invalidate 写入后清理查询缓存，失败时只记录日志。在事务中时推迟到事务提交后
+func (t *Table[T, M]) invalidate(pks ...any) {
+	queryCache := QueryCacheFor(t.Database())
+	if queryCache == nil {
+		return
+	}
+	if t.tx != nil {
+		table := *t
+		table.tx = nil
+		t.tx.AfterCommit(func() { table.invalidate(pks...) })
+		return
+	}
+	if err := queryCache.Invalidate(context.Background(), t.Database(), t.TableName, pks...); err != nil {
+		inlogger.Logger.Warnf("invalidate query cache %s: %v", t.TableName, err)
+	}
+}
+
+func (t *Table[T, M]) execAffected(sqlText string, sqlParams map[string]any) error {
+	result, err := t.namedExec(sqlText, sqlParams)
+	if err != nil {
+		return fmt.Errorf("NamedExec: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// exists 在主库上检查行是否存在，用于写入没有影响任何行时区分版本冲突和行不存在
+func (t *Table[T, M]) exists(pk any) (bool, error) {
+	sqlParams := map[string]any{"uid": pk}
+	filter, err := t.scopeFilter(sqlParams)
+	if err != nil {
+		return false, err
+	}
+	sqlText := fmt.Sprintf(`select count(1) as count from %s where %s = :uid%s;`, t.TableName,
+		conventionsOf[M]().pk, andFilter(filter))
+	var sqlResults []struct {
+		Count int64 `db:"count"`
+	}
+	rows, err := t.primaryQuery(sqlText, sqlParams)
+	if err != nil {
+		return false, fmt.Errorf("NamedQuery: %w", err)
+	}
+	if err = sqlx.StructScan(rows, &sqlResults); err != nil {
+		return false, fmt.Errorf("StructScan: %w", err)
+	}
+	return len(sqlResults) > 0 && sqlResults[0].Count > 0, nil
+}
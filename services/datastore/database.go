@@ -0,0 +1,311 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/pnnh/neutron/services/convert"
+)
+
+const (
+	defaultMaxOpenConns        = 10
+	defaultMaxIdleConns        = 5
+	defaultConnMaxLifetime     = 5 * time.Minute
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultSlowQueryThreshold  = time.Second
+	healthCheckTimeout         = 5 * time.Second
+)
+
+// PoolConfig 连接池配置，零值字段使用默认值
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:    defaultMaxOpenConns,
+		MaxIdleConns:    defaultMaxIdleConns,
+		ConnMaxLifetime: defaultConnMaxLifetime,
+	}
+}
+
+func (p PoolConfig) withDefaults() PoolConfig {
+	defaults := DefaultPoolConfig()
+	if p.MaxOpenConns <= 0 {
+		p.MaxOpenConns = defaults.MaxOpenConns
+	}
+	if p.MaxIdleConns <= 0 {
+		p.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if p.ConnMaxLifetime <= 0 {
+		p.ConnMaxLifetime = defaults.ConnMaxLifetime
+	}
+	return p
+}
+
+func (p PoolConfig) apply(db *sqlx.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// DatabaseConfig 一个逻辑数据库的配置，包含一个主库和若干只读副本
+type DatabaseConfig struct {
+	// Dialect 方言名称，为空时使用 postgres
+	Dialect             string
+	Primary             string
+	Replicas            []string
+	Pool                PoolConfig
+	HealthCheckInterval time.Duration
+	// SlowQueryThreshold 超过该时长的调用标记为慢查询，为0时使用默认值，小于0时不检测
+	SlowQueryThreshold time.Duration
+}
+
+// IConfigGetter 读取配置项的最小接口，config/v2.IConfigStore 满足该接口
+type IConfigGetter = convert.IConfigGetter
+
+// LoadDatabaseConfig 从配置中读取数据库配置，prefix为配置项前缀，例如 DATABASE 对应以下配置项：
+// DATABASE_URL 主库连接串（必填），DATABASE_DIALECT 方言名称，DATABASE_REPLICAS 逗号分隔的副本连接串，
+// DATABASE_MAX_OPEN_CONNS、DATABASE_MAX_IDLE_CONNS 连接数，
+// DATABASE_CONN_MAX_LIFETIME、DATABASE_CONN_MAX_IDLE_TIME、DATABASE_HEALTH_CHECK_INTERVAL、DATABASE_SLOW_QUERY_THRESHOLD 时长（秒或 5m 这样的格式）
+func LoadDatabaseConfig(store IConfigGetter, prefix string) (DatabaseConfig, error) {
+	config := DatabaseConfig{}
+	primary, err := convert.ConfigString(store, prefix+"_URL")
+	if err != nil {
+		return config, err
+	}
+	if primary == "" {
+		return config, fmt.Errorf("配置项[%s_URL]不存在", prefix)
+	}
+	config.Primary = primary
+
+	if config.Dialect, err = convert.ConfigString(store, prefix+"_DIALECT"); err != nil {
+		return config, err
+	}
+	replicas, err := convert.ConfigString(store, prefix+"_REPLICAS")
+	if err != nil {
+		return config, err
+	}
+	for _, v := range strings.Split(replicas, ",") {
+		if dsn := strings.TrimSpace(v); dsn != "" {
+			config.Replicas = append(config.Replicas, dsn)
+		}
+	}
+
+	if config.Pool.MaxOpenConns, err = convert.ConfigInt(store, prefix+"_MAX_OPEN_CONNS"); err != nil {
+		return config, err
+	}
+	if config.Pool.MaxIdleConns, err = convert.ConfigInt(store, prefix+"_MAX_IDLE_CONNS"); err != nil {
+		return config, err
+	}
+	if config.Pool.ConnMaxLifetime, err = convert.ConfigDuration(store, prefix+"_CONN_MAX_LIFETIME"); err != nil {
+		return config, err
+	}
+	if config.Pool.ConnMaxIdleTime, err = convert.ConfigDuration(store, prefix+"_CONN_MAX_IDLE_TIME"); err != nil {
+		return config, err
+	}
+	if config.HealthCheckInterval, err = convert.ConfigDuration(store, prefix+"_HEALTH_CHECK_INTERVAL"); err != nil {
+		return config, err
+	}
+	if config.SlowQueryThreshold, err = convert.ConfigDuration(store, prefix+"_SLOW_QUERY_THRESHOLD"); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+type replica struct {
+	index   int
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// Database 一个逻辑数据库，写操作和事务发往主库，读操作轮询健康的副本，没有健康副本时回退到主库
+type Database struct {
+	name          string
+	dialect       Dialect
+	slowThreshold time.Duration
+	primary       *sqlx.DB
+	replicas      []*replica
+	next          atomic.Uint64
+	stopCh        chan struct{}
+	closeOnce     sync.Once
+}
+
+func openDatabase(dbName string, config DatabaseConfig) (*Database, error) {
+	dialect, err := GetDialect(config.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	pool := config.Pool.withDefaults()
+	primary, err := sqlx.Connect(dialect.DriverName(), config.Primary)
+	if err != nil {
+		return nil, fmt.Errorf("connect error: %w", err)
+	}
+	pool.apply(primary)
+
+	slowThreshold := config.SlowQueryThreshold
+	if slowThreshold == 0 {
+		slowThreshold = defaultSlowQueryThreshold
+	}
+	database := &Database{
+		name:          dbName,
+		dialect:       dialect,
+		slowThreshold: slowThreshold,
+		primary:       primary,
+		stopCh:        make(chan struct{}),
+	}
+	for i, dsn := range config.Replicas {
+		db, err := sqlx.Open(dialect.DriverName(), dsn)
+		if err != nil {
+			_ = database.Close()
+			return nil, fmt.Errorf("open replica %d error: %w", i, err)
+		}
+		pool.apply(db)
+		r := &replica{index: i, db: db}
+		// 副本暂时不可用时不影响初始化，由健康检查在恢复后重新加入轮询
+		if err := pingContext(db); err != nil {
+			inlogger.Logger.Warnf("datastore[%s] replica %d unavailable: %v", dbName, i, err)
+		} else {
+			r.healthy.Store(true)
+		}
+		database.replicas = append(database.replicas, r)
+	}
+
+	interval := config.HealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	if len(database.replicas) > 0 {
+		go database.healthLoop(interval)
+	}
+	return database, nil
+}
+
+func pingContext(db *sqlx.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+func (d *Database) Name() string {
+	return d.name
+}
+
+func (d *Database) Dialect() Dialect {
+	return d.dialect
+}
+
+// Primary 返回主库连接池
+func (d *Database) Primary() *sqlx.DB {
+	return d.primary
+}
+
+// Reader 返回一个用于读操作的连接池
+func (d *Database) Reader() *sqlx.DB {
+	count := len(d.replicas)
+	if count == 0 {
+		return d.primary
+	}
+	start := d.next.Add(1)
+	for i := 0; i < count; i++ {
+		r := d.replicas[(start+uint64(i))%uint64(count)]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return d.primary
+}
+
+func (d *Database) healthLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			d.CheckHealth()
+		}
+	}
+}
+
+// CheckHealth 检查所有副本，不健康的副本会被移出轮询，恢复后重新加入
+func (d *Database) CheckHealth() {
+	for _, r := range d.replicas {
+		err := pingContext(r.db)
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				inlogger.Logger.Infof("datastore[%s] replica %d is healthy again", d.name, r.index)
+			} else {
+				inlogger.Logger.Warnf("datastore[%s] replica %d is unhealthy: %v", d.name, r.index, err)
+			}
+		}
+	}
+}
+
+// PoolStats 单个连接池的使用情况
+type PoolStats struct {
+	Role    string      `json:"role"`
+	Index   int         `json:"index"`
+	Healthy bool        `json:"healthy"`
+	Stats   sql.DBStats `json:"stats"`
+}
+
+// DatabaseStats 一个逻辑数据库下所有连接池的使用情况
+type DatabaseStats struct {
+	Name     string      `json:"name"`
+	Primary  PoolStats   `json:"primary"`
+	Replicas []PoolStats `json:"replicas"`
+}
+
+func (d *Database) Stats() *DatabaseStats {
+	stats := &DatabaseStats{
+		Name: d.name,
+		Primary: PoolStats{
+			Role:    "primary",
+			Healthy: true,
+			Stats:   d.primary.Stats(),
+		},
+		Replicas: make([]PoolStats, 0, len(d.replicas)),
+	}
+	for _, r := range d.replicas {
+		stats.Replicas = append(stats.Replicas, PoolStats{
+			Role:    "replica",
+			Index:   r.index,
+			Healthy: r.healthy.Load(),
+			Stats:   r.db.Stats(),
+		})
+	}
+	return stats
+}
+
+// Close 停止健康检查并关闭所有连接池
+func (d *Database) Close() error {
+	var closeErr error
+	d.closeOnce.Do(func() {
+		close(d.stopCh)
+		for _, r := range d.replicas {
+			if err := r.db.Close(); err != nil && closeErr == nil {
+				closeErr = fmt.Errorf("close replica %d: %w", r.index, err)
+			}
+		}
+		if err := d.primary.Close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("close primary: %w", err)
+		}
+	})
+	return closeErr
+}
@@ -0,0 +1,162 @@
+package datastore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type mapConfig map[string]any
+
+func (m mapConfig) GetValue(key string) (any, error) {
+	value, ok := m[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func TestLoadDatabaseConfig(t *testing.T) {
+	config, err := LoadDatabaseConfig(mapConfig{
+		"MAIN_URL":                   "postgres://primary/app",
+		"MAIN_DIALECT":               "sqlite",
+		"MAIN_REPLICAS":              " postgres://r1/app, ,postgres://r2/app",
+		"MAIN_MAX_OPEN_CONNS":        "20",
+		"MAIN_MAX_IDLE_CONNS":        4,
+		"MAIN_CONN_MAX_LIFETIME":     "10m",
+		"MAIN_CONN_MAX_IDLE_TIME":    30,
+		"MAIN_HEALTH_CHECK_INTERVAL": "15s",
+		"MAIN_SLOW_QUERY_THRESHOLD":  "200ms",
+	}, "MAIN")
+	if err != nil {
+		t.Fatalf("LoadDatabaseConfig: %v", err)
+	}
+	if config.Primary != "postgres://primary/app" || config.Dialect != "sqlite" ||
+		len(config.Replicas) != 2 || config.Replicas[0] != "postgres://r1/app" || config.Replicas[1] != "postgres://r2/app" {
+		t.Fatalf("LoadDatabaseConfig() = %+v", config)
+	}
+	if config.Pool.MaxOpenConns != 20 || config.Pool.MaxIdleConns != 4 ||
+		config.Pool.ConnMaxLifetime != 10*time.Minute || config.Pool.ConnMaxIdleTime != 30*time.Second {
+		t.Fatalf("LoadDatabaseConfig() pool = %+v", config.Pool)
+	}
+	if config.HealthCheckInterval != 15*time.Second || config.SlowQueryThreshold != 200*time.Millisecond {
+		t.Fatalf("LoadDatabaseConfig() = %+v", config)
+	}
+
+	if _, err := LoadDatabaseConfig(mapConfig{}, "MAIN"); err == nil {
+		t.Fatalf("LoadDatabaseConfig() without URL succeeded")
+	}
+	if _, err := LoadDatabaseConfig(mapConfig{"MAIN_URL": "x", "MAIN_MAX_OPEN_CONNS": "many"}, "MAIN"); err == nil {
+		t.Fatalf("LoadDatabaseConfig() with invalid int succeeded")
+	}
+}
+
+// initReplicaForTest 注册一个主库和一个副本都是SQLite文件的数据库，副本不会同步主库的写入
+func initReplicaForTest(t *testing.T, dbName string) {
+	t.Helper()
+	dir := t.TempDir()
+	primaryDsn := filepath.Join(dir, "primary.db")
+	replicaDsn := filepath.Join(dir, "replica.db")
+	for dsn, source := range map[string]string{primaryDsn: "primary", replicaDsn: "replica"} {
+		db, err := sqlx.Connect("sqlite", dsn)
+		if err != nil {
+			t.Fatalf("connect %s: %v", source, err)
+		}
+		_, err = db.Exec(`create table articles (pk text primary key, title text,
+create_time datetime, update_time datetime, deleted boolean, version integer)`)
+		if err == nil {
+			_, err = db.Exec(`create table sources (name text)`)
+		}
+		if err == nil {
+			_, err = db.Exec(`insert into sources (name) values (?)`, source)
+		}
+		_ = db.Close()
+		if err != nil {
+			t.Fatalf("prepare %s: %v", source, err)
+		}
+	}
+	err := InitWithConfig(dbName, DatabaseConfig{
+		Dialect:             DialectSqlite,
+		Primary:             primaryDsn,
+		Replicas:            []string{replicaDsn},
+		HealthCheckInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("InitWithConfig: %v", err)
+	}
+	t.Cleanup(func() { _ = CloseFor(dbName) })
+}
+
+func TestReplicas(t *testing.T) {
+	dbName := "sqlite_replicas"
+	initReplicaForTest(t, dbName)
+
+	source := func(query func(dbName, query string, arg interface{}) (*sqlx.Rows, error)) string {
+		t.Helper()
+		rows, err := query(dbName, `select name from sources`, map[string]any{})
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		defer rows.Close()
+		var name string
+		for rows.Next() {
+			if err := rows.Scan(&name); err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+		}
+		return name
+	}
+	if name := source(NamedQueryReaderFor); name != "replica" {
+		t.Fatalf("NamedQueryReaderFor read from %s, want replica", name)
+	}
+	if name := source(NamedQueryFor); name != "primary" {
+		t.Fatalf("NamedQueryFor read from %s, want primary", name)
+	}
+
+	// 副本还没有复制到新行，写入失败后的存在性检查必须读主库
+	table := NewTable[articleSchema, articleModel]("articles", articleSchema{})
+	table.SetDatabase(dbName)
+	article := &articleModel{Pk: "a1", Title: "hello"}
+	if err := table.Insert(article); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	stale := *article
+	stale.Version = 5
+	if err := table.Update(&stale); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale Update error = %v, want ErrVersionConflict", err)
+	}
+
+	stats, err := StatsFor(dbName)
+	if err != nil {
+		t.Fatalf("StatsFor: %v", err)
+	}
+	if stats.Name != dbName || stats.Primary.Role != "primary" || len(stats.Replicas) != 1 ||
+		!stats.Replicas[0].Healthy || stats.Primary.Stats.MaxOpenConnections != defaultMaxOpenConns {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+	if _, ok := AllStats()[dbName]; !ok {
+		t.Fatalf("AllStats() is missing %s", dbName)
+	}
+
+	// 副本不可用时回退到主库
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		t.Fatalf("GetDatabase: %v", err)
+	}
+	if err := database.replicas[0].db.Close(); err != nil {
+		t.Fatalf("close replica: %v", err)
+	}
+	database.CheckHealth()
+	if database.Reader() != database.Primary() {
+		t.Fatalf("Reader() did not fall back to primary")
+	}
+	if name := source(NamedQueryReaderFor); name != "primary" {
+		t.Fatalf("NamedQueryReaderFor read from %s after replica failure, want primary", name)
+	}
+	if stats := database.Stats(); stats.Replicas[0].Healthy {
+		t.Fatalf("Stats() reports unhealthy replica as healthy")
+	}
+}
@@ -0,0 +1,86 @@
+// Package datastoretest 为基于datastore的代码提供测试辅助：
+//
+//	func TestArticles(t *testing.T) {
+//		db := datastoretest.OpenSqlite(t, datastore.DefaultName)
+//		db.Exec(`create table articles (pk text primary key, title text)`)
+//		db.LoadFixtures("testdata/articles.yaml")
+//		...
+//	}
+//
+// 测试期间注册的数据库上的所有语句都在同一个事务中执行，测试结束时回滚，不会留下数据。
+// 被测试代码开启的事务通过保存点模拟，可以正常提交和回滚
+package datastoretest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pnnh/neutron/services/datastore"
+	_ "modernc.org/sqlite"
+)
+
+// DB 测试期间注册的数据库
+type DB struct {
+	t      testing.TB
+	DbName string
+}
+
+// Open 连接config指定的数据库并开启事务，以dbName注册到datastore。测试结束时回滚事务并注销数据库
+func Open(t testing.TB, dbName string, config datastore.DatabaseConfig) *DB {
+	t.Helper()
+	dialect, err := datastore.GetDialect(config.Dialect)
+	if err != nil {
+		t.Fatalf("datastoretest: %v", err)
+	}
+	realDb, err := sql.Open(dialect.DriverName(), config.Primary)
+	if err != nil {
+		t.Fatalf("datastoretest: open database: %v", err)
+	}
+	tx, err := realDb.Begin()
+	if err != nil {
+		_ = realDb.Close()
+		t.Fatalf("datastoretest: begin transaction: %v", err)
+	}
+	// 所有连接共享同一个事务，txConn 串行执行对事务的调用，因此不需要限制连接数
+	db := sqlx.NewDb(sql.OpenDB(&txConnector{session: &txSession{tx: tx}}), dialect.DriverName())
+	if err := datastore.RegisterDB(dbName, db, dialect.Name()); err != nil {
+		_ = tx.Rollback()
+		_ = realDb.Close()
+		t.Fatalf("datastoretest: register database: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = datastore.CloseFor(dbName)
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("datastoretest: rollback: %v", err)
+		}
+		_ = realDb.Close()
+	})
+	return &DB{t: t, DbName: dbName}
+}
+
+// OpenSqlite 使用临时目录中的SQLite文件作为数据库，不依赖外部服务
+func OpenSqlite(t testing.TB, dbName string) *DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "datastoretest.db")
+	return Open(t, dbName, datastore.DatabaseConfig{Dialect: datastore.DialectSqlite, Primary: dsn})
+}
+
+// Exec 执行一条语句，通常用于建表，出错时终止测试
+func (d *DB) Exec(sqlText string, args ...any) {
+	d.t.Helper()
+	if _, err := datastore.ExecContextFor(d.t.Context(), d.DbName, sqlText, args...); err != nil {
+		d.t.Fatalf("datastoretest: exec %s: %v", sqlText, err)
+	}
+}
+
+// LoadFixtures 把YAML或JSON文件中的数据插入到表中，出错时终止测试
+func (d *DB) LoadFixtures(paths ...string) {
+	d.t.Helper()
+	for _, path := range paths {
+		if err := LoadFixtures(d.DbName, path); err != nil {
+			d.t.Fatalf("datastoretest: %v", err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package datastoretest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/pnnh/neutron/models"
+	"github.com/pnnh/neutron/services/datastore"
+)
+
+type noteModel struct {
+	Pk       string         `db:"pk"`
+	Title    string         `db:"title"`
+	Views    int            `db:"views"`
+	Metadata sql.NullString `db:"metadata"`
+}
+
+type noteSchema struct{}
+
+func (s noteSchema) GetConditions() []datastore.ModelCondition {
+	return nil
+}
+
+var _ datastore.ITableStore[noteModel] = (*datastore.Table[noteSchema, noteModel])(nil)
+
+const createNotes = `create table notes (pk text primary key, title text, views integer, metadata text)`
+
+func TestOpenRollsBack(t *testing.T) {
+	config := datastore.DatabaseConfig{
+		Dialect: datastore.DialectSqlite,
+		Primary: filepath.Join(t.TempDir(), "shared.db"),
+	}
+	if err := datastore.InitWithConfig("datastoretest_setup", config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := datastore.NamedExecFor("datastoretest_setup", createNotes, map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.CloseFor("datastoretest_setup"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			db := Open(t, "datastoretest_shared", config)
+			db.LoadFixtures("testdata/notes.yaml", "testdata/notes.json")
+
+			table := datastore.NewTable[noteSchema, noteModel]("notes", noteSchema{})
+			table.SetDatabase(db.DbName)
+			if count, err := table.Count(); err != nil || count != 3 {
+				t.Fatalf("Count() = %d, %v, want 3 rows from fixtures only", count, err)
+			}
+			note, err := table.Get("b")
+			if err != nil || note.Metadata.String != `{"lang":"go"}` {
+				t.Fatalf("Get() = %+v, %v", note, err)
+			}
+
+			// 被测试代码中的事务通过保存点执行
+			tx, err := datastore.NewTranscationFor(db.DbName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := table.InTransaction(tx).Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			// 持有事务时，事务外的查询和打开的Rows都不会阻塞其他语句
+			if count, err := table.Count(); err != nil || count != 2 {
+				t.Fatalf("Count() while holding a transaction = %d, %v", count, err)
+			}
+			rows, err := datastore.NamedQueryFor(db.DbName, `select pk from notes`, map[string]any{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if note, err := table.Get("b"); err != nil || note == nil {
+				t.Fatalf("Get() with open rows = %+v, %v", note, err)
+			}
+			if err := rows.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+			if note, _ := table.Get("a"); note == nil {
+				t.Fatalf("row deleted in rolled back transaction")
+			}
+		})
+	}
+}
+
+func TestFakeTable(t *testing.T) {
+	var store datastore.ITableStore[noteModel] = NewFakeTable(
+		noteModel{Pk: "a", Title: "first"},
+		noteModel{Pk: "b", Title: "second"},
+	)
+	if err := store.Insert(&noteModel{Pk: "a"}); err == nil {
+		t.Fatalf("expected duplicate key error")
+	}
+	if err := store.Update(&noteModel{Pk: "b", Title: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if note, _ := store.Get("b"); note.Title != "updated" {
+		t.Fatalf("Get() = %+v", note)
+	}
+	if err := store.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("a"); err != models.ErrNotFound {
+		t.Fatalf("Delete() = %v, want ErrNotFound", err)
+	}
+	notes, _ := store.Select(0, 10)
+	if count, _ := store.Count(); count != 1 || len(notes) != 1 || notes[0].Pk != "b" {
+		t.Fatalf("Select() = %+v", notes)
+	}
+}
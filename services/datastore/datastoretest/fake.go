@@ -0,0 +1,114 @@
+package datastoretest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pnnh/neutron/models"
+	"github.com/pnnh/neutron/services/datastore"
+)
+
+// FakeTable 内存中的 datastore.ITableStore 实现，用于不需要数据库的单元测试。
+// 主键按 datastore.PrimaryKeyColumn 的约定读取，行按插入顺序返回
+type FakeTable[M any] struct {
+	mutex sync.RWMutex
+	rows  map[string]M
+	order []string
+}
+
+var _ datastore.ITableStore[struct{}] = (*FakeTable[struct{}])(nil)
+
+func NewFakeTable[M any](rows ...M) *FakeTable[M] {
+	table := &FakeTable[M]{rows: make(map[string]M)}
+	for i := range rows {
+		if err := table.Insert(&rows[i]); err != nil {
+			panic(fmt.Sprintf("NewFakeTable: %v", err))
+		}
+	}
+	return table
+}
+
+func pkOf[M any](model *M) (string, error) {
+	row, err := datastore.DataRowFromStruct(model)
+	if err != nil {
+		return "", err
+	}
+	column := datastore.PrimaryKeyColumn[M]()
+	pk, ok := row.InnerMap()[column]
+	if !ok {
+		return "", fmt.Errorf("primary key column %s not found", column)
+	}
+	return fmt.Sprint(pk), nil
+}
+
+func (f *FakeTable[M]) Get(pk any) (*M, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	model, ok := f.rows[fmt.Sprint(pk)]
+	if !ok {
+		return nil, nil
+	}
+	return &model, nil
+}
+
+func (f *FakeTable[M]) Insert(model *M) error {
+	pk, err := pkOf(model)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.rows[pk]; ok {
+		return fmt.Errorf("duplicate primary key: %s", pk)
+	}
+	f.rows[pk] = *model
+	f.order = append(f.order, pk)
+	return nil
+}
+
+func (f *FakeTable[M]) Update(model *M) error {
+	pk, err := pkOf(model)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.rows[pk]; !ok {
+		return models.ErrNotFound
+	}
+	f.rows[pk] = *model
+	return nil
+}
+
+func (f *FakeTable[M]) Delete(pk any) error {
+	key := fmt.Sprint(pk)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.rows[key]; !ok {
+		return models.ErrNotFound
+	}
+	delete(f.rows, key)
+	for i, v := range f.order {
+		if v == key {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *FakeTable[M]) Select(offset, limit int) ([]M, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	results := make([]M, 0)
+	for i := max(offset, 0); i < len(f.order) && len(results) < limit; i++ {
+		results = append(results, f.rows[f.order[i]])
+	}
+	return results, nil
+}
+
+func (f *FakeTable[M]) Count() (int64, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return int64(len(f.rows)), nil
+}
@@ -0,0 +1,82 @@
+package datastoretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pnnh/neutron/services/datastore"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFixtures 读取YAML或JSON格式的数据文件并插入到dbName中，文件的格式为表名到行列表的映射：
+//
+//	notes:
+//	  - pk: a
+//	    title: first
+//	    metadata: {lang: go}
+//
+// 表按文件中出现的顺序插入，嵌套的对象和数组会序列化为JSON文本
+func LoadFixtures(dbName, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("LoadFixtures read %s: %w", path, err)
+	}
+	// JSON是YAML的子集，两种格式使用同一个解析器
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("LoadFixtures parse %s: %w", path, err)
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("LoadFixtures %s: top level must be a mapping of table names", path)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		tableName := root.Content[i].Value
+		var rows []map[string]any
+		if err := root.Content[i+1].Decode(&rows); err != nil {
+			return fmt.Errorf("LoadFixtures %s table %s: %w", path, tableName, err)
+		}
+		if err := insertFixtureRows(dbName, tableName, rows); err != nil {
+			return fmt.Errorf("LoadFixtures %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func insertFixtureRows(dbName, tableName string, rows []map[string]any) error {
+	if !datastore.IsValidTableName(tableName) {
+		return fmt.Errorf("invalid table name: %s", tableName)
+	}
+	for index, row := range rows {
+		names := make([]string, 0, len(row))
+		params := make(map[string]any, len(row))
+		for name, value := range row {
+			if !datastore.IsValidTableName(name) {
+				return fmt.Errorf("table %s row %d: invalid column name: %s", tableName, index, name)
+			}
+			switch value.(type) {
+			case map[string]any, []any:
+				data, err := json.Marshal(value)
+				if err != nil {
+					return fmt.Errorf("table %s row %d column %s: %w", tableName, index, name, err)
+				}
+				value = string(data)
+			}
+			names = append(names, name)
+			params[name] = value
+		}
+		sort.Strings(names)
+		sqlText := fmt.Sprintf(`insert into %s (%s) values (:%s);`, tableName,
+			strings.Join(names, ", "), strings.Join(names, ", :"))
+		if _, err := datastore.NamedExecFor(dbName, sqlText, params); err != nil {
+			return fmt.Errorf("table %s row %d: %w", tableName, index, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package datastoretest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// txSession 被测试代码共享的事务，所有连接上的语句都在这个事务中执行，
+// 被测试代码开启的事务通过保存点模拟。连接池不限制连接数，
+// 多个连接对事务的每次调用通过mutex串行执行，打开的Rows不会独占事务
+type txSession struct {
+	tx        *sql.Tx
+	mutex     sync.Mutex
+	savepoint int
+}
+
+// locked 在持有锁时调用fn，fn返回后即释放，不会等到Rows关闭
+func locked[V any](s *txSession, fn func() (V, error)) (V, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return fn()
+}
+
+type txConnector struct {
+	session *txSession
+}
+
+func (c *txConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &txConn{session: c.session}, nil
+}
+
+func (c *txConnector) Driver() driver.Driver {
+	return txDriver{}
+}
+
+type txDriver struct{}
+
+func (txDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("datastoretest: use sql.OpenDB with a connector")
+}
+
+type txConn struct {
+	session *txSession
+}
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *txConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := locked(c.session, func() (*sql.Stmt, error) {
+		return c.session.tx.PrepareContext(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &txStmt{session: c.session, stmt: stmt}, nil
+}
+
+// Close 不关闭共享的事务，事务由测试结束时统一回滚
+func (c *txConn) Close() error {
+	return nil
+}
+
+func (c *txConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *txConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return locked(c.session, func() (driver.Tx, error) {
+		c.session.savepoint++
+		name := fmt.Sprintf("neutron_sp_%d", c.session.savepoint)
+		if _, err := c.session.tx.ExecContext(ctx, "savepoint "+name); err != nil {
+			return nil, fmt.Errorf("savepoint: %w", err)
+		}
+		return &savepointTx{session: c.session, name: name}, nil
+	})
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return locked(c.session, func() (driver.Result, error) {
+		return c.session.tx.ExecContext(ctx, query, namedArgs(args)...)
+	})
+}
+
+func (c *txConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return locked(c.session, func() (driver.Rows, error) {
+		rows, err := c.session.tx.QueryContext(ctx, query, namedArgs(args)...)
+		if err != nil {
+			return nil, err
+		}
+		return newTxRows(c.session, rows)
+	})
+}
+
+type savepointTx struct {
+	session *txSession
+	name    string
+}
+
+func (t *savepointTx) Commit() error {
+	_, err := locked(t.session, func() (sql.Result, error) {
+		return t.session.tx.Exec("release savepoint " + t.name)
+	})
+	return err
+}
+
+func (t *savepointTx) Rollback() error {
+	_, err := locked(t.session, func() (sql.Result, error) {
+		return t.session.tx.Exec("rollback to savepoint " + t.name)
+	})
+	return err
+}
+
+type txStmt struct {
+	session *txSession
+	stmt    *sql.Stmt
+}
+
+func (s *txStmt) Close() error {
+	_, err := locked(s.session, func() (struct{}, error) {
+		return struct{}{}, s.stmt.Close()
+	})
+	return err
+}
+
+func (s *txStmt) NumInput() int {
+	return -1
+}
+
+func (s *txStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *txStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *txStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return locked(s.session, func() (driver.Result, error) {
+		return s.stmt.ExecContext(ctx, namedArgs(args)...)
+	})
+}
+
+func (s *txStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return locked(s.session, func() (driver.Rows, error) {
+		rows, err := s.stmt.QueryContext(ctx, namedArgs(args)...)
+		if err != nil {
+			return nil, err
+		}
+		return newTxRows(s.session, rows)
+	})
+}
+
+type txRows struct {
+	session *txSession
+	rows    *sql.Rows
+	columns []string
+}
+
+// newTxRows 调用方需持有session的锁
+func newTxRows(session *txSession, rows *sql.Rows) (*txRows, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	return &txRows{session: session, rows: rows, columns: columns}, nil
+}
+
+func (r *txRows) Columns() []string {
+	return r.columns
+}
+
+func (r *txRows) Close() error {
+	_, err := locked(r.session, func() (struct{}, error) {
+		return struct{}{}, r.rows.Close()
+	})
+	return err
+}
+
+func (r *txRows) Next(dest []driver.Value) error {
+	_, err := locked(r.session, func() (struct{}, error) {
+		return struct{}{}, r.next(dest)
+	})
+	return err
+}
+
+func (r *txRows) next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	values := make([]any, len(dest))
+	pointers := make([]any, len(dest))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := r.rows.Scan(pointers...); err != nil {
+		return err
+	}
+	for i, v := range values {
+		dest[i] = v
+	}
+	return nil
+}
+
+func namedArgs(args []driver.NamedValue) []any {
+	values := make([]any, 0, len(args))
+	for _, v := range args {
+		if v.Name != "" {
+			values = append(values, sql.Named(v.Name, v.Value))
+		} else {
+			values = append(values, v.Value)
+		}
+	}
+	return values
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, 0, len(args))
+	for i, v := range args {
+		values = append(values, driver.NamedValue{Ordinal: i + 1, Value: v})
+	}
+	return values
+}
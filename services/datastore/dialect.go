@@ -0,0 +1,237 @@
+package datastore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect 屏蔽不同数据库之间的SQL差异
+type Dialect interface {
+	// Name 方言名称，用于注册和查找
+	Name() string
+	// DriverName database/sql 驱动名称
+	DriverName() string
+	// Placeholder 第n个（从1开始）位置参数的占位符
+	Placeholder(n int) string
+	// Quote 为标识符加上引号
+	Quote(identifier string) string
+	// LimitOffset 分页子句，limit和offset可以是命名参数或字面量
+	LimitOffset(limit, offset string) string
+	// Upsert 插入冲突时更新的语句，使用 :column 形式的命名参数
+	Upsert(table string, columns, conflictColumns, updateColumns []string) string
+	// SupportsReturning 是否支持 RETURNING 子句
+	SupportsReturning() bool
+	// Returning RETURNING子句，不支持时返回空字符串
+	Returning(columns ...string) string
+	// ColumnType Go类型对应的列类型，用于生成建表语句
+	ColumnType(goType string) string
+}
+
+const (
+	DialectPostgres = "postgres"
+	DialectSqlite   = "sqlite"
+)
+
+var (
+	dialectMap   = make(map[string]Dialect)
+	dialectMutex = sync.RWMutex{}
+)
+
+func init() {
+	RegisterDialect(PostgresDialect{})
+	RegisterDialect(SqliteDialect{})
+}
+
+// RegisterDialect 注册方言，同名方言会被覆盖
+func RegisterDialect(dialect Dialect) {
+	dialectMutex.Lock()
+	dialectMap[dialect.Name()] = dialect
+	dialectMutex.Unlock()
+	if sqlx.BindType(dialect.DriverName()) == sqlx.UNKNOWN {
+		sqlx.BindDriver(dialect.DriverName(), bindTypeOf(dialect))
+	}
+}
+
+func bindTypeOf(dialect Dialect) int {
+	switch dialect.Placeholder(1) {
+	case "?":
+		return sqlx.QUESTION
+	case "$1":
+		return sqlx.DOLLAR
+	case "@p1":
+		return sqlx.AT
+	default:
+		return sqlx.NAMED
+	}
+}
+
+func GetDialect(name string) (Dialect, error) {
+	if name == "" {
+		name = DialectPostgres
+	}
+	dialectMutex.RLock()
+	dialect, ok := dialectMap[name]
+	dialectMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported dialect: %s", name)
+	}
+	return dialect, nil
+}
+
+// DialectFor 返回已注册数据库使用的方言
+func DialectFor(dbName string) (Dialect, error) {
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	return database.Dialect(), nil
+}
+
+func quoteIdentifier(identifier string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// onConflictUpsert PostgreSQL和SQLite(3.24+)共用的 ON CONFLICT 语法
+func onConflictUpsert(dialect Dialect, table string, columns, conflictColumns, updateColumns []string) string {
+	quote := func(list []string) []string {
+		quoted := make([]string, 0, len(list))
+		for _, v := range list {
+			quoted = append(quoted, dialect.Quote(v))
+		}
+		return quoted
+	}
+	params := make([]string, 0, len(columns))
+	for _, v := range columns {
+		params = append(params, ":"+v)
+	}
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("insert into %s (%s) values (%s)", dialect.Quote(table),
+		strings.Join(quote(columns), ", "), strings.Join(params, ", ")))
+	builder.WriteString(fmt.Sprintf(" on conflict (%s)", strings.Join(quote(conflictColumns), ", ")))
+	if len(updateColumns) == 0 {
+		builder.WriteString(" do nothing")
+		return builder.String()
+	}
+	sets := make([]string, 0, len(updateColumns))
+	for _, v := range updateColumns {
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", dialect.Quote(v), dialect.Quote(v)))
+	}
+	builder.WriteString(" do update set " + strings.Join(sets, ", "))
+	return builder.String()
+}
+
+func returningClause(dialect Dialect, columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	quoted := make([]string, 0, len(columns))
+	for _, v := range columns {
+		if v == "*" {
+			quoted = append(quoted, v)
+		} else {
+			quoted = append(quoted, dialect.Quote(v))
+		}
+	}
+	return " returning " + strings.Join(quoted, ", ")
+}
+
+type PostgresDialect struct{}
+
+func (d PostgresDialect) Name() string {
+	return DialectPostgres
+}
+
+func (d PostgresDialect) DriverName() string {
+	return "postgres"
+}
+
+func (d PostgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (d PostgresDialect) Quote(identifier string) string {
+	return quoteIdentifier(identifier)
+}
+
+func (d PostgresDialect) LimitOffset(limit, offset string) string {
+	return fmt.Sprintf(" offset %s limit %s", offset, limit)
+}
+
+func (d PostgresDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	return onConflictUpsert(d, table, columns, conflictColumns, updateColumns)
+}
+
+func (d PostgresDialect) SupportsReturning() bool {
+	return true
+}
+
+func (d PostgresDialect) Returning(columns ...string) string {
+	return returningClause(d, columns)
+}
+
+func (d PostgresDialect) ColumnType(goType string) string {
+	switch goType {
+	case "float64":
+		return "double precision"
+	case "time":
+		return "timestamptz"
+	default:
+		return TypeToDbType(goType)
+	}
+}
+
+// SqliteDialect 适用于 modernc.org/sqlite 驱动，使用前需要在程序中导入该驱动
+type SqliteDialect struct{}
+
+func (d SqliteDialect) Name() string {
+	return DialectSqlite
+}
+
+func (d SqliteDialect) DriverName() string {
+	return "sqlite"
+}
+
+func (d SqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (d SqliteDialect) Quote(identifier string) string {
+	return quoteIdentifier(identifier)
+}
+
+func (d SqliteDialect) LimitOffset(limit, offset string) string {
+	return fmt.Sprintf(" limit %s offset %s", limit, offset)
+}
+
+func (d SqliteDialect) Upsert(table string, columns, conflictColumns, updateColumns []string) string {
+	return onConflictUpsert(d, table, columns, conflictColumns, updateColumns)
+}
+
+func (d SqliteDialect) SupportsReturning() bool {
+	return true
+}
+
+func (d SqliteDialect) Returning(columns ...string) string {
+	return returningClause(d, columns)
+}
+
+func (d SqliteDialect) ColumnType(goType string) string {
+	switch goType {
+	case "int", "int64", "bool":
+		return "integer"
+	case "float64":
+		return "real"
+	case "time":
+		return "datetime"
+	default:
+		return "text"
+	}
+}
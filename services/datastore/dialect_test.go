@@ -0,0 +1,109 @@
+package datastore
+
+import (
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+type noteModel struct {
+	Pk    string `db:"pk"`
+	Title string `db:"title"`
+	Views int    `db:"views"`
+}
+
+type noteSchema struct {
+	Pk    ModelCondition
+	Title ModelCondition
+}
+
+func (s noteSchema) GetConditions() []ModelCondition {
+	return []ModelCondition{s.Pk, s.Title}
+}
+
+func initSqliteForTest(t *testing.T, dbName string) {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	if err := InitWithConfig(dbName, DatabaseConfig{Dialect: DialectSqlite, Primary: dsn}); err != nil {
+		t.Fatalf("InitWithConfig: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = CloseFor(dbName)
+	})
+	_, err := NamedExecFor(dbName, `create table notes (pk text primary key, title text, views integer)`, map[string]any{})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+}
+
+func TestSqliteTable(t *testing.T) {
+	dbName := "sqlite_table"
+	initSqliteForTest(t, dbName)
+
+	dialect, err := DialectFor(dbName)
+	if err != nil {
+		t.Fatalf("DialectFor: %v", err)
+	}
+	upsertText := dialect.Upsert("notes", []string{"pk", "title", "views"}, []string{"pk"}, []string{"title", "views"})
+	for _, v := range []map[string]any{
+		{"pk": "a", "title": "first", "views": 1},
+		{"pk": "b", "title": "second", "views": 2},
+		{"pk": "a", "title": "first again", "views": 3},
+	} {
+		if _, err := NamedExecFor(dbName, upsertText, v); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+	}
+
+	table := NewTable[noteSchema, noteModel]("notes", noteSchema{})
+	table.SetDatabase(dbName)
+
+	count, err := table.Count()
+	if err != nil || count != 2 {
+		t.Fatalf("Count() = %d, %v, want 2", count, err)
+	}
+	note, err := table.Get("a")
+	if err != nil || note == nil {
+		t.Fatalf("Get() = %v, %v", note, err)
+	}
+	if note.Title != "first again" || note.Views != 3 {
+		t.Errorf("Get() = %+v, want upserted row", note)
+	}
+	notes, err := table.Select(1, 10)
+	if err != nil || len(notes) != 1 {
+		t.Fatalf("Select() = %v, %v, want 1 row", notes, err)
+	}
+
+	row, err := NewGetQueryFor(dbName, "notes", "pk = :pk", "", "", map[string]any{"pk": "b"})
+	if err != nil || row == nil {
+		t.Fatalf("NewGetQueryFor() = %v, %v", row, err)
+	}
+	if title := row.GetString("title"); title != "second" {
+		t.Errorf("title = %s, want second", title)
+	}
+}
+
+func TestDialectSql(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		limit   string
+		upsert  string
+	}{
+		{"postgres", PostgresDialect{}, " offset :offset limit :limit",
+			`insert into "t" ("id", "name") values (:id, :name) on conflict ("id") do update set "name" = excluded."name"`},
+		{"sqlite", SqliteDialect{}, " limit :limit offset :offset",
+			`insert into "t" ("id", "name") values (:id, :name) on conflict ("id") do update set "name" = excluded."name"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.LimitOffset(":limit", ":offset"); got != tt.limit {
+				t.Errorf("LimitOffset() = %q, want %q", got, tt.limit)
+			}
+			if got := tt.dialect.Upsert("t", []string{"id", "name"}, []string{"id"}, []string{"name"}); got != tt.upsert {
+				t.Errorf("Upsert() = %q, want %q", got, tt.upsert)
+			}
+		})
+	}
+}
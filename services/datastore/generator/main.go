@@ -17,6 +17,9 @@ import (
 	"github.com/pnnh/neutron/services/datastore"
 )
 
+// columnType 字段类型到列类型的映射，设置 NEUTRON_DIALECT 环境变量时使用对应方言的类型
+var columnType = datastore.TypeToDbType
+
 type ModelField struct {
 	Name     string
 	Type     string
@@ -33,6 +36,14 @@ func main() {
 	goFile := os.Getenv("GOFILE")
 	inlogger.Logger.Println("goFile", goFile)
 
+	if dialectName := os.Getenv("NEUTRON_DIALECT"); dialectName != "" {
+		dialect, err := datastore.GetDialect(dialectName)
+		if err != nil {
+			inlogger.Logger.Fatalln("不支持的方言", err)
+		}
+		columnType = dialect.ColumnType
+	}
+
 	fullPath := ""
 	if goFile == "" {
 		fullPath = os.Args[1]
@@ -185,7 +196,7 @@ func ParseAstStructType(genDecl *ast.GenDecl, typeSpec *ast.TypeSpec, structType
 				Name:     name.Name,
 				Type:     fieldType,
 				DbColumn: dbTag,
-				DbType:   datastore.TypeToDbType(fieldType),
+				DbType:   columnType(fieldType),
 			})
 		}
 	}
@@ -0,0 +1,192 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	OperationQuery    = "query"
+	OperationExec     = "exec"
+	OperationSelect   = "select"
+	OperationQueryRow = "query_row"
+	OperationBegin    = "begin"
+	OperationCommit   = "commit"
+	OperationRollback = "rollback"
+	OperationCopyIn   = "copy_in"
+	OperationCopyOut  = "copy_out"
+)
+
+// QueryEvent 一次数据库调用的信息，Rows为-1表示行数未知。NamedQueryFor 和 QueryRowFor 返回尚未遍历的结果，
+// 事件在调用返回时就已通知，因此它们的Rows总是-1，需要统计返回行数时使用 SelectFor
+type QueryEvent struct {
+	DbName      string
+	Operation   string
+	Query       string
+	Args        any
+	InTx        bool
+	Start       time.Time
+	Duration    time.Duration
+	Rows        int64
+	Slow        bool
+	Err         error
+	Fingerprint string
+}
+
+// QueryHook 数据库调用的拦截器，BeforeQuery按注册顺序调用，AfterQuery按相反顺序调用
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, event *QueryEvent) context.Context
+	AfterQuery(ctx context.Context, event *QueryEvent)
+}
+
+var (
+	queryHooks     []QueryHook
+	queryHookMutex = sync.RWMutex{}
+)
+
+func RegisterQueryHook(hook QueryHook) {
+	queryHookMutex.Lock()
+	defer queryHookMutex.Unlock()
+	queryHooks = append(queryHooks, hook)
+}
+
+// ClearQueryHooks 移除所有已注册的拦截器
+func ClearQueryHooks() {
+	queryHookMutex.Lock()
+	defer queryHookMutex.Unlock()
+	queryHooks = nil
+}
+
+func currentQueryHooks() []QueryHook {
+	queryHookMutex.RLock()
+	defer queryHookMutex.RUnlock()
+	return queryHooks
+}
+
+// observe 执行fn并通知所有拦截器，fn返回受影响或返回的行数
+func observe(ctx context.Context, database *Database, event *QueryEvent, fn func(ctx context.Context) (int64, error)) error {
+	hooks := currentQueryHooks()
+	if len(hooks) == 0 {
+		_, err := fn(ctx)
+		return err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if database != nil {
+		event.DbName = database.name
+	}
+	event.Fingerprint = Fingerprint(event.Query)
+	for _, hook := range hooks {
+		ctx = hook.BeforeQuery(ctx, event)
+	}
+	event.Start = time.Now()
+	event.Rows, event.Err = fn(ctx)
+	event.Duration = time.Since(event.Start)
+	if database != nil && database.slowThreshold > 0 {
+		event.Slow = event.Duration >= database.slowThreshold
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterQuery(ctx, event)
+	}
+	return event.Err
+}
+
+var (
+	fingerprintStringRegex = regexp.MustCompile(`'(?:[^']|'')*'`)
+	fingerprintNumberRegex = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	fingerprintSpaceRegex  = regexp.MustCompile(`\s+`)
+	fingerprintListRegex   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+)
+
+// Fingerprint 归一化SQL语句，去掉字面量和多余空白，用于按语句聚合指标
+func Fingerprint(query string) string {
+	text := fingerprintStringRegex.ReplaceAllString(query, "?")
+	text = fingerprintNumberRegex.ReplaceAllString(text, "?")
+	text = fingerprintListRegex.ReplaceAllString(text, "(?)")
+	text = fingerprintSpaceRegex.ReplaceAllString(text, " ")
+	text = strings.TrimSpace(text)
+	text = strings.TrimSuffix(text, ";")
+	return strings.ToLower(strings.TrimSpace(text))
+}
+
+// RedactArgs 隐藏参数值，只保留参数名和类型，避免敏感数据进入日志
+func RedactArgs(args any) any {
+	if args == nil {
+		return nil
+	}
+	value := reflect.ValueOf(args)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		redacted := make(map[string]string, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			redacted[fmt.Sprint(iter.Key().Interface())] = redactedValue(iter.Value())
+		}
+		return redacted
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return redactedValue(value)
+		}
+		redacted := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			redacted = append(redacted, redactedValue(value.Index(i)))
+		}
+		return redacted
+	default:
+		return redactedValue(value)
+	}
+}
+
+func redactedValue(value reflect.Value) string {
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "<nil>"
+		}
+		value = value.Elem()
+	}
+	return "<" + value.Type().String() + ">"
+}
+
+// LoggingHook 通过inlogger输出结构化的SQL日志，慢查询以Warn级别输出
+type LoggingHook struct{}
+
+func NewLoggingHook() *LoggingHook {
+	return &LoggingHook{}
+}
+
+func (h *LoggingHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *LoggingHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	entry := inlogger.Logger.WithFields(logrus.Fields{
+		"db":          event.DbName,
+		"operation":   event.Operation,
+		"duration_ms": float64(event.Duration.Microseconds()) / 1000,
+		"rows":        event.Rows,
+		"in_tx":       event.InTx,
+		"args":        RedactArgs(event.Args),
+	})
+	if event.Err != nil {
+		entry.WithError(event.Err).Errorf("sql error: %s", event.Query)
+	} else if event.Slow {
+		entry.Warnf("slow sql: %s", event.Query)
+	} else {
+		entry.Debugf("sql: %s", event.Query)
+	}
+}
@@ -0,0 +1,84 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+)
+
+type recordingHook struct {
+	events []QueryEvent
+}
+
+func (h *recordingHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *recordingHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	h.events = append(h.events, *event)
+}
+
+func TestQueryHooks(t *testing.T) {
+	dbName := "sqlite_hook"
+	initSqliteForTest(t, dbName)
+
+	recorder := &recordingHook{}
+	metrics := NewMetricsHook()
+	RegisterQueryHook(recorder)
+	RegisterQueryHook(metrics)
+	t.Cleanup(ClearQueryHooks)
+
+	for i := 0; i < 3; i++ {
+		_, err := NamedExecFor(dbName, `insert into notes (pk, title, views) values (:pk, 'x', 1)`,
+			map[string]any{"pk": string(rune('a' + i))})
+		if err != nil {
+			t.Fatalf("NamedExecFor: %v", err)
+		}
+	}
+	var titles []string
+	if err := SelectFor(dbName, &titles, `select title from notes where views = ?`, 1); err != nil {
+		t.Fatalf("SelectFor: %v", err)
+	}
+	if _, err := NamedExecFor(dbName, `insert into missing (pk) values (:pk)`, map[string]any{"pk": "z"}); err == nil {
+		t.Fatalf("NamedExecFor on missing table should fail")
+	}
+	// 返回未遍历结果的调用不知道行数
+	rows, err := NamedQueryFor(dbName, `select title from notes`, map[string]any{})
+	if err != nil {
+		t.Fatalf("NamedQueryFor: %v", err)
+	}
+	_ = rows.Close()
+	var count int
+	if err := QueryRowFor(dbName, `select count(1) from notes`).Scan(&count); err != nil || count != 3 {
+		t.Fatalf("QueryRowFor() = %d, %v", count, err)
+	}
+
+	if len(recorder.events) != 7 {
+		t.Fatalf("recorded %d events, want 7", len(recorder.events))
+	}
+	if event := recorder.events[3]; event.Operation != OperationSelect || event.Rows != 3 || event.DbName != dbName {
+		t.Errorf("select event = %+v", event)
+	}
+	for _, event := range recorder.events[5:] {
+		if event.Rows != -1 {
+			t.Errorf("%s event rows = %d, want -1", event.Operation, event.Rows)
+		}
+	}
+
+	snapshot := metrics.Snapshot()
+	dbMetrics := snapshot.Databases[dbName]
+	if dbMetrics.Count != 7 || dbMetrics.Errors != 1 || dbMetrics.Rows != 6 {
+		t.Errorf("database metrics = %+v", dbMetrics)
+	}
+	top := snapshot.Statements[0]
+	if top.Count != 3 || top.Fingerprint != "insert into notes (pk, title, views) values (:pk, ?, ?)" {
+		t.Errorf("top statement = %+v", top)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	redacted := RedactArgs(map[string]any{"password": "secret", "age": 3})
+	values := redacted.(map[string]string)
+	if values["password"] != "<string>" || values["age"] != "<int>" {
+		t.Errorf("RedactArgs() = %v", redacted)
+	}
+}
@@ -0,0 +1,197 @@
+package datastore
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pnnh/neutron/helpers/jsonmap"
+)
+
+// JSON JSON/JSONB列的包装类型，可直接作为模型字段使用：
+//
+//	Metadata datastore.JSON[map[string]any] `db:"metadata"`
+//
+// 数据库中的NULL对应 Valid 为 false
+type JSON[T any] struct {
+	Data  T
+	Valid bool
+}
+
+func NewJSON[T any](data T) JSON[T] {
+	return JSON[T]{Data: data, Valid: true}
+}
+
+func (j *JSON[T]) Scan(src any) error {
+	var zero T
+	if src == nil {
+		j.Data, j.Valid = zero, false
+		return nil
+	}
+	text, ok := textOf(src)
+	if !ok {
+		return fmt.Errorf("JSON.Scan: unsupported type %T", src)
+	}
+	data := zero
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		return fmt.Errorf("JSON.Scan: %w", err)
+	}
+	j.Data, j.Valid = data, true
+	return nil
+}
+
+func (j JSON[T]) Value() (driver.Value, error) {
+	if !j.Valid {
+		return nil, nil
+	}
+	data, err := json.Marshal(j.Data)
+	if err != nil {
+		return nil, fmt.Errorf("JSON.Value: %w", err)
+	}
+	return string(data), nil
+}
+
+func (j JSON[T]) MarshalJSON() ([]byte, error) {
+	if !j.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(j.Data)
+}
+
+func (j *JSON[T]) UnmarshalJSON(data []byte) error {
+	var zero T
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		j.Data, j.Valid = zero, false
+		return nil
+	}
+	value := zero
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	j.Data, j.Valid = value, true
+	return nil
+}
+
+// TryGetJsonMap 把JSON对象列解码为JsonMap
+func (m *DataRow) TryGetJsonMap(key string) (*jsonmap.JsonMap, error) {
+	dataMap := make(map[string]interface{})
+	if err := m.TryGetJSON(key, &dataMap); err != nil {
+		return nil, fmt.Errorf("TryGetJsonMap error, %w", err)
+	}
+	return jsonmap.ConvertJsonMap(dataMap), nil
+}
+
+func (m *DataRow) GetJsonMap(key string) *jsonmap.JsonMap {
+	mapVal, err := m.TryGetJsonMap(key)
+	if err != nil {
+		panic(fmt.Sprintf("GetJsonMap error, key: %s, error: %v", key, err))
+	}
+	return mapVal
+}
+
+// GetJSONAs 把JSON列解码为T类型的值
+func GetJSONAs[T any](row *DataRow, key string) (T, error) {
+	var value T
+	if err := row.TryGetJSON(key, &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// JSONB路径运算符，仅PostgreSQL支持
+const (
+	JsonOperatorGet      = "->"
+	JsonOperatorGetText  = "->>"
+	JsonOperatorContains = "@>"
+	JsonOperatorHasKey   = "?"
+)
+
+// JsonGet 以JSONB类型比较path处的值，例如 Metadata.JsonGet("lang").Eq("go") 生成
+// metadata -> 'lang' = cast(:metadata as jsonb)，比较值会被序列化为JSON
+func (m *ModelCondition) JsonGet(path ...string) *ModelCondition {
+	m.JsonOperator = JsonOperatorGet
+	m.JsonPath = path
+	return m
+}
+
+// JsonText 以文本类型比较path处的值，例如 Metadata.JsonText("author", "name").Eq("alice") 生成
+// metadata #>> '{"author","name"}' = :metadata
+func (m *ModelCondition) JsonText(path ...string) *ModelCondition {
+	m.JsonOperator = JsonOperatorGetText
+	m.JsonPath = path
+	return m
+}
+
+// Contains 判断JSONB列是否包含value，生成 metadata @> cast(:metadata as jsonb)
+func (m *ModelCondition) Contains(value any) *ModelCondition {
+	m.DbCondition = "and"
+	m.DbOperator = JsonOperatorContains
+	m.JsonOperator = JsonOperatorContains
+	m.JsonPath = nil
+	m.Changed = true
+	m.Value = value
+	return m
+}
+
+// HasKey 判断JSONB对象是否包含顶层键key，生成 metadata ? :metadata
+func (m *ModelCondition) HasKey(key string) *ModelCondition {
+	m.DbCondition = "and"
+	m.DbOperator = JsonOperatorHasKey
+	m.JsonOperator = JsonOperatorHasKey
+	m.JsonPath = nil
+	m.Changed = true
+	m.Value = key
+	return m
+}
+
+// ParamName 条件在命名参数中使用的名称
+func (m *ModelCondition) ParamName() string {
+	return m.DbColumn
+}
+
+// ParamValue 条件的参数值，JSONB比较时序列化为JSON文本
+func (m *ModelCondition) ParamValue() (any, error) {
+	if m.JsonOperator != JsonOperatorGet && m.JsonOperator != JsonOperatorContains {
+		return m.Value, nil
+	}
+	data, err := json.Marshal(m.Value)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal %s: %w", m.DbColumn, err)
+	}
+	return string(data), nil
+}
+
+// Expression 条件对应的SQL表达式，不包含前面的and/or
+func (m *ModelCondition) Expression() string {
+	column := m.DbColumn
+	param := ":" + m.ParamName()
+	switch m.JsonOperator {
+	case JsonOperatorGet:
+		column = jsonPathExpr(column, "->", "#>", m.JsonPath)
+		param = fmt.Sprintf("cast(%s as jsonb)", param)
+	case JsonOperatorGetText:
+		column = jsonPathExpr(column, "->>", "#>>", m.JsonPath)
+	case JsonOperatorContains:
+		param = fmt.Sprintf("cast(%s as jsonb)", param)
+	}
+	return fmt.Sprintf("%s %s %s", column, m.DbOperator, param)
+}
+
+func jsonPathExpr(column, operator, pathOperator string, path []string) string {
+	if len(path) == 1 {
+		return fmt.Sprintf("%s %s %s", column, operator, quoteLiteral(path[0]))
+	}
+	elements := make([]string, 0, len(path))
+	for _, v := range path {
+		v = strings.ReplaceAll(v, `\`, `\\`)
+		elements = append(elements, `"`+strings.ReplaceAll(v, `"`, `\"`)+`"`)
+	}
+	return fmt.Sprintf("%s %s %s", column, pathOperator, quoteLiteral("{"+strings.Join(elements, ",")+"}"))
+}
+
+// quoteLiteral 把文本转义为SQL字符串字面量
+func quoteLiteral(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
@@ -0,0 +1,97 @@
+package datastore
+
+import (
+	"testing"
+)
+
+type settingsModel struct {
+	Pk       string                  `db:"pk"`
+	Options  map[string]any          `db:"options" dbtype:"json"`
+	Profile  JSON[map[string]string] `db:"profile"`
+	Labels   []string                `db:"labels" dbtype:"array"`
+	Disabled JSON[[]int]             `db:"disabled"`
+	Raw      string                  `db:"raw" dbtype:"json"`
+	Point    point                   `db:"point"`
+}
+
+// point 没有声明dbtype的结构体字段，写入时原样交给驱动
+type point struct {
+	X, Y int
+}
+
+func TestJSONScanValue(t *testing.T) {
+	var value JSON[map[string]int]
+	if err := value.Scan([]byte(`{"a":1}`)); err != nil || !value.Valid || value.Data["a"] != 1 {
+		t.Fatalf("Scan = %v, %v", value, err)
+	}
+	dbValue, err := value.Value()
+	if err != nil || dbValue != `{"a":1}` {
+		t.Fatalf("Value = %v, %v", dbValue, err)
+	}
+	if err := value.Scan(nil); err != nil || value.Valid {
+		t.Fatalf("Scan nil = %v, %v", value, err)
+	}
+	if dbValue, _ := value.Value(); dbValue != nil {
+		t.Fatalf("Value of null = %v", dbValue)
+	}
+}
+
+func TestReflectColumnsJSON(t *testing.T) {
+	columns, err := ReflectColumns(&settingsModel{
+		Pk:      "s1",
+		Options: map[string]any{"theme": "dark"},
+		Profile: NewJSON(map[string]string{"lang": "go"}),
+		Labels:  []string{"a", "b"},
+		Raw:     `{"a":1}`,
+		Point:   point{X: 1, Y: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns["options"] != `{"theme":"dark"}` || columns["labels"] != `{"a","b"}` || columns["raw"] != `{"a":1}` {
+		t.Fatalf("unexpected columns: %v", columns)
+	}
+	if columns["point"] != (point{X: 1, Y: 2}) {
+		t.Fatalf("untagged struct field was converted: %#v", columns["point"])
+	}
+	if dbValue, _ := columns["profile"].(JSON[map[string]string]).Value(); dbValue != `{"lang":"go"}` {
+		t.Fatalf("unexpected profile: %v", columns["profile"])
+	}
+
+	row := MapToDataRow(map[string]any{"options": []byte(`{"theme":"dark","size":12}`)})
+	options := row.GetJsonMap("options")
+	if options.GetString("theme") != "dark" || options.GetInt("size") != 12 {
+		t.Fatalf("unexpected options: %v", options.InnerMap())
+	}
+	typed, err := GetJSONAs[map[string]any](row, "options")
+	if err != nil || typed["theme"] != "dark" {
+		t.Fatalf("GetJSONAs = %v, %v", typed, err)
+	}
+}
+
+func TestJsonConditions(t *testing.T) {
+	cases := []struct {
+		cond  *ModelCondition
+		expr  string
+		value any
+	}{
+		{condition().JsonText("lang").Eq("go"), `options ->> 'lang' = :options`, "go"},
+		{condition().JsonText("author", "name").Eq("alice"), `options #>> '{"author","name"}' = :options`, "alice"},
+		{condition().JsonGet("size").Eq(12), `options -> 'size' = cast(:options as jsonb)`, "12"},
+		{condition().Contains(map[string]string{"theme": "dark"}), `options @> cast(:options as jsonb)`, `{"theme":"dark"}`},
+		{condition().HasKey("theme"), `options ? :options`, "theme"},
+	}
+	for _, c := range cases {
+		if expr := c.cond.Expression(); expr != c.expr {
+			t.Errorf("Expression = %s, want %s", expr, c.expr)
+		}
+		if value, err := c.cond.ParamValue(); err != nil || value != c.value {
+			t.Errorf("ParamValue = %v, %v, want %v", value, err, c.value)
+		}
+	}
+}
+
+func condition() *ModelCondition {
+	cond := NewCondition("Options", "map", "options", "jsonb")
+	return &cond
+}
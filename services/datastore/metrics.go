@@ -0,0 +1,153 @@
+package datastore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets 延迟直方图的桶上限，最后一个桶之外的调用计入溢出桶
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// QueryMetrics 一组调用的计数和延迟直方图，Buckets比LatencyBuckets多一个溢出桶
+type QueryMetrics struct {
+	Count         int64         `json:"count"`
+	Errors        int64         `json:"errors"`
+	Slow          int64         `json:"slow"`
+	Rows          int64         `json:"rows"`
+	TotalDuration time.Duration `json:"total_duration"`
+	MaxDuration   time.Duration `json:"max_duration"`
+	Buckets       []int64       `json:"buckets"`
+}
+
+func newQueryMetrics() *QueryMetrics {
+	return &QueryMetrics{Buckets: make([]int64, len(LatencyBuckets)+1)}
+}
+
+func (m *QueryMetrics) observe(event *QueryEvent) {
+	m.Count++
+	if event.Err != nil {
+		m.Errors++
+	}
+	if event.Slow {
+		m.Slow++
+	}
+	if event.Rows > 0 {
+		m.Rows += event.Rows
+	}
+	m.TotalDuration += event.Duration
+	if event.Duration > m.MaxDuration {
+		m.MaxDuration = event.Duration
+	}
+	index := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return event.Duration <= LatencyBuckets[i]
+	})
+	m.Buckets[index]++
+}
+
+func (m *QueryMetrics) copy() QueryMetrics {
+	result := *m
+	result.Buckets = append([]int64(nil), m.Buckets...)
+	return result
+}
+
+// StatementMetrics 按数据库和语句指纹聚合的指标
+type StatementMetrics struct {
+	DbName      string `json:"db_name"`
+	Fingerprint string `json:"fingerprint"`
+	QueryMetrics
+}
+
+type MetricsSnapshot struct {
+	Databases  map[string]QueryMetrics `json:"databases"`
+	Statements []StatementMetrics      `json:"statements"`
+}
+
+type statementKey struct {
+	dbName      string
+	fingerprint string
+}
+
+// MetricsHook 在内存中累计每个数据库和每条语句的调用次数、错误数、慢查询数和延迟直方图
+type MetricsHook struct {
+	mutex      sync.Mutex
+	databases  map[string]*QueryMetrics
+	statements map[statementKey]*QueryMetrics
+}
+
+func NewMetricsHook() *MetricsHook {
+	return &MetricsHook{
+		databases:  make(map[string]*QueryMetrics),
+		statements: make(map[statementKey]*QueryMetrics),
+	}
+}
+
+func (h *MetricsHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *MetricsHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	dbMetrics, ok := h.databases[event.DbName]
+	if !ok {
+		dbMetrics = newQueryMetrics()
+		h.databases[event.DbName] = dbMetrics
+	}
+	dbMetrics.observe(event)
+
+	if event.Fingerprint == "" {
+		return
+	}
+	key := statementKey{dbName: event.DbName, fingerprint: event.Fingerprint}
+	stmtMetrics, ok := h.statements[key]
+	if !ok {
+		stmtMetrics = newQueryMetrics()
+		h.statements[key] = stmtMetrics
+	}
+	stmtMetrics.observe(event)
+}
+
+// Snapshot 返回当前指标的副本，语句按调用次数从多到少排序
+func (h *MetricsHook) Snapshot() *MetricsSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	snapshot := &MetricsSnapshot{
+		Databases:  make(map[string]QueryMetrics, len(h.databases)),
+		Statements: make([]StatementMetrics, 0, len(h.statements)),
+	}
+	for name, v := range h.databases {
+		snapshot.Databases[name] = v.copy()
+	}
+	for key, v := range h.statements {
+		snapshot.Statements = append(snapshot.Statements, StatementMetrics{
+			DbName:       key.dbName,
+			Fingerprint:  key.fingerprint,
+			QueryMetrics: v.copy(),
+		})
+	}
+	sort.Slice(snapshot.Statements, func(i, j int) bool {
+		return snapshot.Statements[i].Count > snapshot.Statements[j].Count
+	})
+	return snapshot
+}
+
+func (h *MetricsHook) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.databases = make(map[string]*QueryMetrics)
+	h.statements = make(map[statementKey]*QueryMetrics)
+}
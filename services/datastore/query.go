@@ -1,12 +1,16 @@
 package datastore
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"maps"
 	"reflect"
 	"strings"
 
 	"github.com/iancoleman/strcase"
+	"github.com/jmoiron/sqlx"
+	"github.com/pnnh/neutron/internal/inlogger"
 	"github.com/pnnh/neutron/services/strutil"
 )
 
@@ -15,7 +19,13 @@ func IsValidTableName(tableName string) bool {
 }
 
 func NewGetQuery(tableName string, whereText, orderText, extraText string,
-	sqlParams map[string]any) (tabMap *DataRow, getErr error) {
+	sqlParams map[string]any) (*DataRow, error) {
+	return NewGetQueryFor(DefaultName, tableName, whereText, orderText, extraText, sqlParams)
+}
+
+// NewGetQueryFor 查询满足条件的一行，数据库启用了查询缓存时按表、SQL语句和参数缓存结果
+func NewGetQueryFor(dbName, tableName string, whereText, orderText, extraText string,
+	sqlParams map[string]any) (*DataRow, error) {
 	if !IsValidTableName(tableName) {
 		return nil, fmt.Errorf("invalid table name: %s", tableName)
 	}
@@ -32,7 +42,33 @@ func NewGetQuery(tableName string, whereText, orderText, extraText string,
 	}
 	pageSqlText := builder.String()
 
-	rows, err := NamedQuery(pageSqlText, sqlParams)
+	queryCache := QueryCacheFor(dbName)
+	if queryCache == nil {
+		return getQuery(dbName, pageSqlText, sqlParams, NamedQueryReaderFor)
+	}
+	ctx := context.Background()
+	key, err := queryCache.queryKey(ctx, dbName, tableName, pageSqlText, sqlParams)
+	if err != nil {
+		inlogger.Logger.Warnf("query cache key %s: %v", tableName, err)
+		return getQuery(dbName, pageSqlText, sqlParams, NamedQueryReaderFor)
+	}
+	// 写入后副本可能还没有同步，缓存的数据从主库读取
+	dataMap, err := cachedLoad(ctx, queryCache, key, func() (map[string]interface{}, bool, error) {
+		row, err := getQuery(dbName, pageSqlText, sqlParams, NamedQueryFor)
+		if err != nil || row == nil {
+			return nil, false, err
+		}
+		return row.InnerMap(), true, nil
+	})
+	if err != nil || dataMap == nil {
+		return nil, err
+	}
+	return MapToDataRow(maps.Clone(dataMap)), nil
+}
+
+func getQuery(dbName, pageSqlText string, sqlParams map[string]any,
+	query func(dbName, query string, arg interface{}) (*sqlx.Rows, error)) (tabMap *DataRow, getErr error) {
+	rows, err := query(dbName, pageSqlText, sqlParams)
 	if err != nil {
 		return nil, fmt.Errorf("NewSelectQuery: %w", err)
 	}
@@ -108,6 +144,15 @@ func ReflectColumns(s interface{}) (map[string]any, error) {
 			}
 		default:
 			colValue = val
+			// 声明了dbtype的JSON列和数组列转换为数据库可接受的值，未声明的字段原样传给驱动
+			dbType := strings.ToLower(field.Tag.Get(dbTypeTag))
+			if !field.Type.Implements(valuerType) && (isJSONType(dbType) || dbType == dbTypeArray) {
+				jsonValue, err := columnValue(fieldValue, dbType)
+				if err != nil {
+					return nil, fmt.Errorf("ReflectColumns field %s: %w", field.Name, err)
+				}
+				colValue = jsonValue
+			}
 		}
 		columnMap[colName] = colValue
 	}
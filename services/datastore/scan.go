@@ -0,0 +1,377 @@
+package datastore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pnnh/neutron/services/convert"
+)
+
+// 字段上的 dbtype 标签用于声明列的存储方式：
+//
+//	Tags     []string       `db:"tags" dbtype:"array"`   // PostgreSQL数组
+//	Metadata map[string]any `db:"metadata" dbtype:"json"` // JSON/JSONB
+//
+// 未声明时，ScanInto 和 DataRowFromStruct 把map、结构体和切片（[]byte除外）按JSON处理，读取时遇到 {a,b} 形式的文本
+// 会按PostgreSQL数组解析；ReflectColumns（Table的写入）只转换声明了dbtype的字段。声明为JSON的字符串和[]byte字段
+// 被视为已经编码好的JSON，原样写入
+const (
+	dbTypeTag   = "dbtype"
+	dbTypeJSON  = "json"
+	dbTypeJSONB = "jsonb"
+	dbTypeArray = "array"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte(nil))
+)
+
+type structField struct {
+	name   string
+	column string
+	index  []int
+	typ    reflect.Type
+	dbType string
+}
+
+var structFieldCache sync.Map
+
+// structFieldsOf 返回结构体中映射到列的字段，包括匿名嵌入结构体中的字段
+func structFieldsOf(structType reflect.Type) []structField {
+	if cached, ok := structFieldCache.Load(structType); ok {
+		return cached.([]structField)
+	}
+	fields := make([]structField, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		dbTag := field.Tag.Get("db")
+		if dbTag == "-" {
+			continue
+		}
+		if field.Anonymous && dbTag == "" && field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			for _, inner := range structFieldsOf(field.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, structField{
+			name:   field.Name,
+			column: columnName(field),
+			index:  field.Index,
+			typ:    field.Type,
+			dbType: strings.ToLower(field.Tag.Get(dbTypeTag)),
+		})
+	}
+	structFieldCache.Store(structType, fields)
+	return fields
+}
+
+func structValueOf(model any, needPointer bool) (reflect.Value, error) {
+	value := reflect.ValueOf(model)
+	if !value.IsValid() {
+		return value, fmt.Errorf("model is nil")
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return value, fmt.Errorf("model is nil pointer")
+		}
+		value = value.Elem()
+	} else if needPointer {
+		return value, fmt.Errorf("model must be a pointer to struct, got %T", model)
+	}
+	if value.Kind() != reflect.Struct {
+		return value, fmt.Errorf("model must be a struct, got %T", model)
+	}
+	return value, nil
+}
+
+// ScanInto 把DataRow中的值按db标签写入结构体，dest必须是结构体指针。没有对应字段的列会被忽略
+func (m *DataRow) ScanInto(dest any) error {
+	value, err := structValueOf(dest, true)
+	if err != nil {
+		return fmt.Errorf("ScanInto: %w", err)
+	}
+	for _, field := range structFieldsOf(value.Type()) {
+		src, ok := m.dataMap[field.column]
+		if !ok {
+			continue
+		}
+		target := value.FieldByIndex(field.index)
+		if err := assignValue(target, src, field.dbType); err != nil {
+			return fmt.Errorf("ScanInto column %s -> field %s (%s): %w", field.column, field.name, field.typ, err)
+		}
+	}
+	return nil
+}
+
+// DataRowFromStruct 把结构体按db标签转换为DataRow，sql.Null*、UUID等实现了driver.Valuer的字段转换为其数据库值，
+// JSON字段序列化为字符串，PostgreSQL数组字段转换为数组字面量
+func DataRowFromStruct(model any) (*DataRow, error) {
+	value, err := structValueOf(model, false)
+	if err != nil {
+		return nil, fmt.Errorf("DataRowFromStruct: %w", err)
+	}
+	row := NewDataRow()
+	for _, field := range structFieldsOf(value.Type()) {
+		colValue, err := columnValue(value.FieldByIndex(field.index), field.dbType)
+		if err != nil {
+			return nil, fmt.Errorf("DataRowFromStruct field %s -> column %s: %w", field.name, field.column, err)
+		}
+		row.setValue(field.column, colValue)
+	}
+	return row, nil
+}
+
+func isJSONKind(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Struct:
+		return typ != timeType
+	case reflect.Slice, reflect.Array:
+		return typ.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+func isJSONType(dbType string) bool {
+	return dbType == dbTypeJSON || dbType == dbTypeJSONB
+}
+
+func columnValue(field reflect.Value, dbType string) (any, error) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, nil
+		}
+		if !field.Type().Implements(valuerType) {
+			return columnValue(field.Elem(), dbType)
+		}
+	}
+	if field.Type().Implements(valuerType) {
+		return field.Interface().(driver.Valuer).Value()
+	}
+	if dbType == dbTypeArray {
+		return pq.Array(field.Interface()).Value()
+	}
+	if isJSONType(dbType) {
+		switch {
+		case field.Kind() == reflect.String:
+			return field.String(), nil
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8:
+			if field.IsNil() {
+				return nil, nil
+			}
+			return string(field.Bytes()), nil
+		}
+	}
+	if isJSONType(dbType) || isJSONKind(field.Type()) {
+		if (field.Kind() == reflect.Map || field.Kind() == reflect.Slice) && field.IsNil() {
+			return nil, nil
+		}
+		data, err := json.Marshal(field.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal: %w", err)
+		}
+		return string(data), nil
+	}
+	return field.Interface(), nil
+}
+
+// assignValue 把数据库返回的值写入目标字段，按需完成类型转换
+func assignValue(target reflect.Value, src any, dbType string) error {
+	if src == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	if target.CanAddr() && target.Addr().Type().Implements(scannerType) {
+		return target.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+	if target.Kind() == reflect.Ptr {
+		elem := reflect.New(target.Type().Elem())
+		if err := assignValue(elem.Elem(), src, dbType); err != nil {
+			return err
+		}
+		target.Set(elem)
+		return nil
+	}
+	srcValue := reflect.ValueOf(src)
+	if srcValue.Type().AssignableTo(target.Type()) && !isJSONKind(target.Type()) {
+		target.Set(srcValue)
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		strVal, err := convert.ToString(src)
+		if err != nil {
+			return err
+		}
+		target.SetString(strVal)
+		return nil
+	case reflect.Bool:
+		boolVal, err := toBool(src)
+		if err != nil {
+			return err
+		}
+		target.SetBool(boolVal)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intVal, err := toInt64(src)
+		if err != nil {
+			return err
+		}
+		if target.OverflowInt(intVal) {
+			return fmt.Errorf("value %d overflows %s", intVal, target.Type())
+		}
+		target.SetInt(intVal)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		intVal, err := toInt64(src)
+		if err != nil {
+			return err
+		}
+		if intVal < 0 || target.OverflowUint(uint64(intVal)) {
+			return fmt.Errorf("value %d overflows %s", intVal, target.Type())
+		}
+		target.SetUint(uint64(intVal))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		floatVal, err := toFloat64(src)
+		if err != nil {
+			return err
+		}
+		target.SetFloat(floatVal)
+		return nil
+	}
+
+	if target.Type() == timeType {
+		timeVal, err := convert.ConvertTime(normalizeText(src))
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(timeVal))
+		return nil
+	}
+	if target.Type() == bytesType {
+		switch v := src.(type) {
+		case []byte:
+			target.SetBytes(append([]byte(nil), v...))
+			return nil
+		case string:
+			target.SetBytes([]byte(v))
+			return nil
+		}
+		return fmt.Errorf("unsupported type %T for conversion to []byte", src)
+	}
+
+	text, isText := textOf(src)
+	if target.Kind() == reflect.Slice && (dbType == dbTypeArray || (isText && strings.HasPrefix(text, "{"))) {
+		if !isText {
+			return fmt.Errorf("unsupported type %T for conversion to array", src)
+		}
+		return pq.Array(target.Addr().Interface()).Scan(text)
+	}
+	if isJSONKind(target.Type()) {
+		if !isText {
+			return fmt.Errorf("unsupported type %T for conversion to json", src)
+		}
+		ptr := reflect.New(target.Type())
+		if err := json.Unmarshal([]byte(text), ptr.Interface()); err != nil {
+			return fmt.Errorf("json.Unmarshal: %w", err)
+		}
+		target.Set(ptr.Elem())
+		return nil
+	}
+	if srcValue.Type().ConvertibleTo(target.Type()) {
+		target.Set(srcValue.Convert(target.Type()))
+		return nil
+	}
+	return fmt.Errorf("unsupported type %T for conversion to %s", src, target.Type())
+}
+
+func textOf(src any) (string, bool) {
+	switch v := src.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+// normalizeText 把驱动返回的[]byte转换为字符串，其他值原样返回
+func normalizeText(src any) any {
+	if data, ok := src.([]byte); ok {
+		return string(data)
+	}
+	return src
+}
+
+func toBool(src any) (bool, error) {
+	switch v := normalizeText(src).(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "t", "true", "1", "y", "yes", "on":
+			return true, nil
+		case "f", "false", "0", "n", "no", "off":
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot convert string to bool: %s", v)
+	case nil:
+		return false, fmt.Errorf("cannot convert nil to bool")
+	}
+	intVal, err := toInt64(src)
+	if err != nil {
+		return false, fmt.Errorf("unsupported type %T for conversion to bool", src)
+	}
+	return intVal != 0, nil
+}
+
+func toInt64(src any) (int64, error) {
+	switch v := normalizeText(src).(type) {
+	case string:
+		intVal, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert string to int64: %s", v)
+		}
+		return intVal, nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case float32:
+		return int64(v), nil
+	}
+	return convert.ToInt64(src)
+}
+
+func toFloat64(src any) (float64, error) {
+	switch v := normalizeText(src).(type) {
+	case string:
+		floatVal, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert string to float64: %s", v)
+		}
+		return floatVal, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return convert.ToFloat64(v)
+	}
+	return 0, fmt.Errorf("unsupported type %T for conversion to float64", src)
+}
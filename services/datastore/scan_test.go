@@ -0,0 +1,91 @@
+package datastore
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type profileBase struct {
+	Pk string `db:"pk"`
+}
+
+type profileModel struct {
+	profileBase
+	Name      sql.NullString    `db:"name"`
+	Age       int               `db:"age"`
+	Score     float64           `db:"score"`
+	Active    bool              `db:"active"`
+	Owner     uuid.UUID         `db:"owner"`
+	Tags      []string          `db:"tags" dbtype:"array"`
+	Metadata  map[string]string `db:"metadata"`
+	Nickname  *string           `db:"nickname"`
+	LoginTime time.Time         `db:"login_time"`
+	ignored   string
+}
+
+func TestDataRowScanInto(t *testing.T) {
+	owner := uuid.New()
+	loginTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	row := MapToDataRow(map[string]any{
+		"pk":         "p1",
+		"name":       []byte("alice"),
+		"age":        int64(30),
+		"score":      []byte("9.5"),
+		"active":     "t",
+		"owner":      owner.String(),
+		"tags":       []byte(`{go,"sql db"}`),
+		"metadata":   []byte(`{"city":"paris"}`),
+		"nickname":   "al",
+		"login_time": loginTime.Format(time.RFC3339),
+		"unknown":    1,
+	})
+	var profile profileModel
+	if err := row.ScanInto(&profile); err != nil {
+		t.Fatalf("ScanInto: %v", err)
+	}
+	want := profileModel{
+		profileBase: profileBase{Pk: "p1"},
+		Name:        sql.NullString{String: "alice", Valid: true},
+		Age:         30,
+		Score:       9.5,
+		Active:      true,
+		Owner:       owner,
+		Tags:        []string{"go", "sql db"},
+		Metadata:    map[string]string{"city": "paris"},
+		Nickname:    profile.Nickname,
+		LoginTime:   loginTime,
+	}
+	if !reflect.DeepEqual(profile, want) || profile.Nickname == nil || *profile.Nickname != "al" {
+		t.Errorf("ScanInto() = %+v, want %+v", profile, want)
+	}
+
+	back, err := DataRowFromStruct(profile)
+	if err != nil {
+		t.Fatalf("DataRowFromStruct: %v", err)
+	}
+	var again profileModel
+	if err := back.ScanInto(&again); err != nil {
+		t.Fatalf("ScanInto round trip: %v", err)
+	}
+	if !reflect.DeepEqual(again.Tags, profile.Tags) || again.Owner != owner || again.Name != profile.Name ||
+		again.Metadata["city"] != "paris" {
+		t.Errorf("round trip = %+v, want %+v", again, profile)
+	}
+	if value := back.InnerMap()["tags"]; value != `{"go","sql db"}` {
+		t.Errorf("tags column = %v", value)
+	}
+}
+
+func TestDataRowScanIntoError(t *testing.T) {
+	row := MapToDataRow(map[string]any{"age": "old"})
+	var profile profileModel
+	err := row.ScanInto(&profile)
+	if err == nil || !strings.Contains(err.Error(), "column age -> field Age") {
+		t.Errorf("ScanInto error = %v, want column and field names", err)
+	}
+}
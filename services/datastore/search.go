@@ -0,0 +1,278 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pnnh/neutron/models"
+)
+
+// 全文检索查询文本的解析方式，分别对应PostgreSQL的同名函数
+const (
+	SearchModePlain     = "plainto_tsquery"
+	SearchModePhrase    = "phraseto_tsquery"
+	SearchModeWebsearch = "websearch_to_tsquery"
+	SearchModeRaw       = "to_tsquery"
+)
+
+const (
+	searchQueryParam  = "neutron_search_query"
+	searchScoreColumn = "neutron_search_score"
+	searchHeadColumn  = "neutron_search_headline"
+)
+
+// SearchColumn 参与检索的列，Weight为 A、B、C、D 之一，为空时不设置权重
+type SearchColumn struct {
+	Column string
+	Weight string
+}
+
+// SearchOptions 全文检索参数，仅PostgreSQL支持
+type SearchOptions struct {
+	// Query 用户输入的查询文本
+	Query string
+	// Config 文本检索配置，例如 english、simple，默认为 simple
+	Config string
+	// Mode 查询文本的解析方式，默认为 SearchModePlain
+	Mode string
+	// Columns 参与检索的列及其权重
+	Columns []SearchColumn
+	// VectorColumn 预先计算好的tsvector列，设置后忽略Columns，便于使用GIN索引
+	VectorColumn string
+	// HeadlineColumn 生成高亮片段的列，为空时不生成
+	HeadlineColumn string
+	// HeadlineOptions 传给ts_headline的选项，例如 "StartSel=<mark>, StopSel=</mark>, MaxFragments=2"
+	HeadlineOptions string
+	Page            int
+	Size            int
+}
+
+// SearchResult 一条检索结果，Score为ts_rank计算的相关度
+type SearchResult[M any] struct {
+	Model    M       `json:"model"`
+	Score    float64 `json:"score"`
+	Headline string  `json:"headline,omitempty"`
+}
+
+func (r *SearchResult[M]) ToViewModel() interface{} {
+	var view any = r.Model
+	if viewModel, ok := view.(models.NEViewModel); ok {
+		view = viewModel.ToViewModel()
+	} else if row, ok := view.(*DataRow); ok {
+		view = row.InnerMap()
+	}
+	return &SearchResult[any]{Model: view, Score: r.Score, Headline: r.Headline}
+}
+
+func (o *SearchOptions) withDefaults() SearchOptions {
+	options := *o
+	if options.Config == "" {
+		options.Config = "simple"
+	}
+	if options.Mode == "" {
+		options.Mode = SearchModePlain
+	}
+	if options.Page < 1 {
+		options.Page = 1
+	}
+	if options.Size < 1 {
+		options.Size = 10
+	}
+	return options
+}
+
+func (o *SearchOptions) validate() error {
+	switch o.Mode {
+	case SearchModePlain, SearchModePhrase, SearchModeWebsearch, SearchModeRaw:
+	default:
+		return fmt.Errorf("invalid search mode: %s", o.Mode)
+	}
+	if !IsValidTableName(o.Config) {
+		return fmt.Errorf("invalid search config: %s", o.Config)
+	}
+	if o.VectorColumn == "" && len(o.Columns) == 0 {
+		return fmt.Errorf("search columns is empty")
+	}
+	names := []string{o.VectorColumn, o.HeadlineColumn}
+	for _, v := range o.Columns {
+		names = append(names, v.Column)
+		switch v.Weight {
+		case "", "A", "B", "C", "D":
+		default:
+			return fmt.Errorf("invalid search weight: %s", v.Weight)
+		}
+	}
+	for _, name := range names {
+		if name != "" && !IsValidTableName(name) {
+			return fmt.Errorf("invalid search column: %s", name)
+		}
+	}
+	return nil
+}
+
+func (o *SearchOptions) vectorExpr() string {
+	if o.VectorColumn != "" {
+		return o.VectorColumn
+	}
+	config := quoteLiteral(o.Config)
+	parts := make([]string, 0, len(o.Columns))
+	for _, v := range o.Columns {
+		part := fmt.Sprintf("to_tsvector(%s, coalesce(%s, ''))", config, v.Column)
+		if v.Weight != "" {
+			part = fmt.Sprintf("setweight(%s, '%s')", part, v.Weight)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " || ")
+}
+
+func (o *SearchOptions) queryExpr() string {
+	return fmt.Sprintf("%s(%s, :%s)", o.Mode, quoteLiteral(o.Config), searchQueryParam)
+}
+
+// searchSql 生成检索和计数语句，whereText为附加条件
+func searchSql(tableName string, options SearchOptions, whereText string) (string, string) {
+	vector := options.vectorExpr()
+	query := options.queryExpr()
+	columns := fmt.Sprintf("*, ts_rank(%s, %s) as %s", vector, query, searchScoreColumn)
+	if options.HeadlineColumn != "" {
+		headline := fmt.Sprintf("ts_headline(%s, coalesce(%s, ''), %s", quoteLiteral(options.Config),
+			options.HeadlineColumn, query)
+		if options.HeadlineOptions != "" {
+			headline += ", " + quoteLiteral(options.HeadlineOptions)
+		}
+		columns += fmt.Sprintf(", %s) as %s", headline, searchHeadColumn)
+	}
+	condition := fmt.Sprintf("%s @@ %s", vector, query) + andFilter(whereText)
+	selectText := fmt.Sprintf(`select %s from %s where %s order by %s desc offset %d limit %d;`,
+		columns, tableName, condition, searchScoreColumn, (options.Page-1)*options.Size, options.Size)
+	countText := fmt.Sprintf(`select count(1) as count from %s where %s;`, tableName, condition)
+	return selectText, countText
+}
+
+// searchFor 执行检索，返回DataRow形式的结果，行中不包含评分和高亮列。query用于执行语句，Table通过它在事务中检索
+func searchFor(dbName, tableName string, opts SearchOptions, whereText string, sqlParams map[string]any,
+	query func(sqlText string, arg any) (*sqlx.Rows, error)) (*models.NESelectResult[*SearchResult[*DataRow]], error) {
+	if !IsValidTableName(tableName) {
+		return nil, fmt.Errorf("invalid table name: %s", tableName)
+	}
+	dialect, err := DialectFor(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("dialect: %w", err)
+	}
+	if dialect.Name() != DialectPostgres {
+		return nil, fmt.Errorf("full text search is not supported by dialect %s", dialect.Name())
+	}
+	options := opts.withDefaults()
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	params := make(map[string]any, len(sqlParams)+1)
+	for k, v := range sqlParams {
+		params[k] = v
+	}
+	params[searchQueryParam] = options.Query
+	selectText, countText := searchSql(tableName, options, whereText)
+
+	var count int
+	countRows, err := query(countText, params)
+	if err != nil {
+		return nil, fmt.Errorf("NamedQuery: %w", err)
+	}
+	for countRows.Next() {
+		if err := countRows.Scan(&count); err != nil {
+			_ = countRows.Close()
+			return nil, fmt.Errorf("Scan: %w", err)
+		}
+	}
+	if err := countRows.Err(); err != nil {
+		_ = countRows.Close()
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	// 在执行第二个查询前释放连接，事务中同一连接上不能同时打开两个结果集
+	if err := countRows.Close(); err != nil {
+		return nil, fmt.Errorf("close rows: %w", err)
+	}
+
+	rows, err := query(selectText, params)
+	if err != nil {
+		return nil, fmt.Errorf("NamedQuery: %w", err)
+	}
+	defer rows.Close()
+	result := &models.NESelectResult[*SearchResult[*DataRow]]{
+		Page:  options.Page,
+		Size:  options.Size,
+		Count: count,
+		Range: make([]*SearchResult[*DataRow], 0, options.Size),
+	}
+	for rows.Next() {
+		rowMap := make(map[string]interface{})
+		if err := rows.MapScan(rowMap); err != nil {
+			return nil, fmt.Errorf("MapScan: %w", err)
+		}
+		item := &SearchResult[*DataRow]{}
+		if item.Score, err = toFloat64(rowMap[searchScoreColumn]); err != nil {
+			return nil, fmt.Errorf("search score: %w", err)
+		}
+		if headline, ok := textOf(rowMap[searchHeadColumn]); ok {
+			item.Headline = headline
+		}
+		delete(rowMap, searchScoreColumn)
+		delete(rowMap, searchHeadColumn)
+		item.Model = MapToDataRow(rowMap)
+		result.Range = append(result.Range, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return result, nil
+}
+
+// NewSearchQuery 在表中执行全文检索，whereText和sqlParams为附加的过滤条件及其参数
+func NewSearchQuery(tableName string, opts SearchOptions, whereText string,
+	sqlParams map[string]any) (*models.NESelectResult[*SearchResult[*DataRow]], error) {
+	return NewSearchQueryFor(DefaultName, tableName, opts, whereText, sqlParams)
+}
+
+func NewSearchQueryFor(dbName, tableName string, opts SearchOptions, whereText string,
+	sqlParams map[string]any) (*models.NESelectResult[*SearchResult[*DataRow]], error) {
+	result, err := searchFor(dbName, tableName, opts, whereText, sqlParams,
+		func(sqlText string, arg any) (*sqlx.Rows, error) { return NamedQueryReaderFor(dbName, sqlText, arg) })
+	if err != nil {
+		return nil, fmt.Errorf("NewSearchQuery: %w", err)
+	}
+	return result, nil
+}
+
+// Search 在表中执行全文检索，结果按相关度降序排列，已软删除和其他租户的行会被排除
+func (t *Table[T, M]) Search(opts SearchOptions) (*models.NESelectResult[*SearchResult[M]], error) {
+	if t.needTenantSchema() {
+		return inTenantSchema(t, func(t *Table[T, M]) (*models.NESelectResult[*SearchResult[M]], error) {
+			return t.Search(opts)
+		})
+	}
+	sqlParams := map[string]any{}
+	filter, err := t.scopeFilter(sqlParams)
+	if err != nil {
+		return nil, fmt.Errorf("Search: %w", err)
+	}
+	rowResult, err := searchFor(t.Database(), t.TableName, opts, filter, sqlParams, t.namedQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Search: %w", err)
+	}
+	result := &models.NESelectResult[*SearchResult[M]]{
+		Page:  rowResult.Page,
+		Size:  rowResult.Size,
+		Count: rowResult.Count,
+		Range: make([]*SearchResult[M], 0, len(rowResult.Range)),
+	}
+	for _, v := range rowResult.Range {
+		item := &SearchResult[M]{Score: v.Score, Headline: v.Headline}
+		if err := v.Model.ScanInto(&item.Model); err != nil {
+			return nil, fmt.Errorf("Search: %w", err)
+		}
+		result.Range = append(result.Range, item)
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package datastore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchSql(t *testing.T) {
+	options := (&SearchOptions{
+		Query:           "golang",
+		Config:          "english",
+		Columns:         []SearchColumn{{Column: "title", Weight: "A"}, {Column: "body", Weight: "B"}},
+		HeadlineColumn:  "body",
+		HeadlineOptions: "StartSel=<mark>, StopSel=</mark>",
+		Page:            2,
+		Size:            5,
+	}).withDefaults()
+	if err := options.validate(); err != nil {
+		t.Fatal(err)
+	}
+	selectText, countText := searchSql("articles", options, "status = :status")
+
+	vector := "setweight(to_tsvector('english', coalesce(title, '')), 'A') || " +
+		"setweight(to_tsvector('english', coalesce(body, '')), 'B')"
+	query := "plainto_tsquery('english', :neutron_search_query)"
+	for _, want := range []string{
+		"ts_rank(" + vector + ", " + query + ") as neutron_search_score",
+		"ts_headline('english', coalesce(body, ''), " + query + ", 'StartSel=<mark>, StopSel=</mark>') as neutron_search_headline",
+		"where " + vector + " @@ " + query + " and status = :status",
+		"order by neutron_search_score desc offset 5 limit 5",
+	} {
+		if !strings.Contains(selectText, want) {
+			t.Errorf("select sql missing %q:\n%s", want, selectText)
+		}
+	}
+	if !strings.HasPrefix(countText, "select count(1) as count from articles where "+vector) {
+		t.Errorf("unexpected count sql: %s", countText)
+	}
+
+	invalid := []SearchOptions{
+		{Query: "x"},
+		{Query: "x", Columns: []SearchColumn{{Column: "title", Weight: "E"}}},
+		{Query: "x", Columns: []SearchColumn{{Column: "title; drop table x"}}},
+		{Query: "x", VectorColumn: "tsv", Config: "english'"},
+		{Query: "x", VectorColumn: "tsv", Mode: "ts_delete"},
+	}
+	for _, v := range invalid {
+		options := v.withDefaults()
+		if err := options.validate(); err == nil {
+			t.Errorf("expected validate error for %+v", v)
+		}
+	}
+}
+
+func TestSearchRequiresPostgres(t *testing.T) {
+	initSqliteForTest(t, "search_sqlite")
+	_, err := NewSearchQueryFor("search_sqlite", "notes", SearchOptions{Query: "x", VectorColumn: "tsv"}, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected unsupported dialect error, got %v", err)
+	}
+}
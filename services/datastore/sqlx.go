@@ -3,125 +3,260 @@ package datastore
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"reflect"
 	"sync"
-	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
 var (
-	sqlMap      = make(map[string]*sqlx.DB)
+	sqlMap      = make(map[string]*Database)
 	sqlMutex    = sync.RWMutex{}
 	DefaultName = "default"
 )
 
+var ErrDatabaseNotInitialized = errors.New("database not initialized")
+
 func InitFor(dbName string, dsn string) error {
-	db, err := sqlx.Connect("postgres", dsn)
+	return InitWithConfig(dbName, DatabaseConfig{Primary: dsn})
+}
+
+func Init(dsn string) error {
+	return InitFor(DefaultName, dsn)
+}
+
+// InitWithConfig 按配置注册一个逻辑数据库，同名数据库已存在时会关闭旧的连接池
+func InitWithConfig(dbName string, config DatabaseConfig) error {
+	database, err := openDatabase(dbName, config)
+	if err != nil {
+		return err
+	}
+	return register(dbName, database)
+}
+
+// RegisterDB 把已打开的连接池注册为逻辑数据库，例如测试中包装了事务的连接池。dialectName为空时使用PostgreSQL
+func RegisterDB(dbName string, db *sqlx.DB, dialectName string) error {
+	dialect, err := GetDialect(dialectName)
 	if err != nil {
-		return fmt.Errorf("connect error: %w", err)
+		return err
+	}
+	database := &Database{
+		name:          dbName,
+		dialect:       dialect,
+		slowThreshold: defaultSlowQueryThreshold,
+		primary:       db,
+		stopCh:        make(chan struct{}),
 	}
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	return register(dbName, database)
+}
+
+func register(dbName string, database *Database) error {
 	sqlMutex.Lock()
-	sqlMap[dbName] = db
+	previous := sqlMap[dbName]
+	sqlMap[dbName] = database
 	sqlMutex.Unlock()
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			return fmt.Errorf("close previous database: %w", err)
+		}
+	}
 	return nil
 }
 
-func Init(dsn string) error {
-	return InitFor(DefaultName, dsn)
+func GetDatabase(dbName string) (*Database, error) {
+	sqlMutex.RLock()
+	database, exists := sqlMap[dbName]
+	sqlMutex.RUnlock()
+	if !exists {
+		return nil, ErrDatabaseNotInitialized
+	}
+	return database, nil
 }
 
-func NamedQueryFor(dbName, query string, arg interface{}) (*sqlx.Rows, error) {
+func StatsFor(dbName string) (*DatabaseStats, error) {
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	return database.Stats(), nil
+}
+
+func Stats() (*DatabaseStats, error) {
+	return StatsFor(DefaultName)
+}
+
+// AllStats 返回所有已注册数据库的连接池使用情况
+func AllStats() map[string]*DatabaseStats {
 	sqlMutex.RLock()
-	sqlxdb, exists := sqlMap[dbName]
-	sqlMutex.RUnlock()
+	defer sqlMutex.RUnlock()
+	result := make(map[string]*DatabaseStats, len(sqlMap))
+	for name, database := range sqlMap {
+		result[name] = database.Stats()
+	}
+	return result
+}
+
+func CloseFor(dbName string) error {
+	sqlMutex.Lock()
+	database, exists := sqlMap[dbName]
+	delete(sqlMap, dbName)
+	sqlMutex.Unlock()
 	if !exists {
-		return nil, fmt.Errorf("database not initialized")
+		return ErrDatabaseNotInitialized
 	}
-	return sqlxdb.NamedQuery(query, arg)
+	return database.Close()
+}
+
+// CloseAll 关闭所有已注册的数据库，用于程序退出时释放连接
+func CloseAll() error {
+	sqlMutex.Lock()
+	databases := sqlMap
+	sqlMap = make(map[string]*Database)
+	sqlMutex.Unlock()
+	var closeErr error
+	for name, database := range databases {
+		if err := database.Close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("close %s: %w", name, err)
+		}
+	}
+	return closeErr
+}
+
+// NamedQueryFor 在主库上执行查询，适用于 insert ... returning 和写入后需要立即读到新数据的查询。
+// 结果由调用方遍历，拦截器收到的行数为-1
+func NamedQueryFor(dbName, query string, arg interface{}) (*sqlx.Rows, error) {
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	return namedQuery(database, database.Primary(), query, arg)
 }
 
 func NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
 	return NamedQueryFor(DefaultName, query, arg)
 }
 
+// NamedQueryReaderFor 在只读副本上执行查询，没有健康的副本时使用主库。副本可能有复制延迟，只用于普通的select
+func NamedQueryReaderFor(dbName, query string, arg interface{}) (*sqlx.Rows, error) {
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	return namedQuery(database, database.Reader(), query, arg)
+}
+
+func NamedQueryReader(query string, arg interface{}) (*sqlx.Rows, error) {
+	return NamedQueryReaderFor(DefaultName, query, arg)
+}
+
+func namedQuery(database *Database, db *sqlx.DB, query string, arg interface{}) (*sqlx.Rows, error) {
+	var rows *sqlx.Rows
+	event := &QueryEvent{Operation: OperationQuery, Query: query, Args: arg}
+	err := observe(context.Background(), database, event, func(ctx context.Context) (int64, error) {
+		var queryErr error
+		rows, queryErr = db.NamedQueryContext(ctx, query, arg)
+		return -1, queryErr
+	})
+	return rows, err
+}
+
 func NamedExecFor(dbName, query string, arg interface{}) (sql.Result, error) {
-	sqlMutex.RLock()
-	sqlxdb, exists := sqlMap[dbName]
-	sqlMutex.RUnlock()
-	if !exists {
-		return nil, fmt.Errorf("database not initialized")
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return nil, err
 	}
-	return sqlxdb.NamedExec(query, arg)
+	var result sql.Result
+	event := &QueryEvent{Operation: OperationExec, Query: query, Args: arg}
+	err = observe(context.Background(), database, event, func(ctx context.Context) (int64, error) {
+		var execErr error
+		result, execErr = database.Primary().NamedExecContext(ctx, query, arg)
+		return rowsAffected(result), execErr
+	})
+	return result, err
 }
 func NamedExec(query string, arg interface{}) (sql.Result, error) {
 	return NamedExecFor(DefaultName, query, arg)
 }
 
+// QueryRowFor 在只读副本上查询一行，结果在Scan时才读取，拦截器收到的行数为-1
 func QueryRowFor(dbName, query string, args ...any) *sql.Row {
-
-	sqlMutex.RLock()
-	sqlxdb, exists := sqlMap[dbName]
-	sqlMutex.RUnlock()
-	if !exists {
+	database, err := GetDatabase(dbName)
+	if err != nil {
 		return nil
 	}
-	return sqlxdb.QueryRow(query, args...)
+	var row *sql.Row
+	event := &QueryEvent{Operation: OperationQueryRow, Query: query, Args: args}
+	_ = observe(context.Background(), database, event, func(ctx context.Context) (int64, error) {
+		row = database.Reader().QueryRowContext(ctx, query, args...)
+		return -1, nil
+	})
+	return row
 }
 func QueryRow(query string, args ...any) *sql.Row {
 	return QueryRowFor(DefaultName, query, args...)
 }
 
 func SelectFor(dbName string, dest interface{}, query string, args ...interface{}) error {
-
-	sqlMutex.RLock()
-	sqlxdb, exists := sqlMap[dbName]
-	sqlMutex.RUnlock()
-	if !exists {
-		return fmt.Errorf("database not initialized")
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return err
 	}
-	return sqlxdb.Select(dest, query, args...)
+	event := &QueryEvent{Operation: OperationSelect, Query: query, Args: args}
+	return observe(context.Background(), database, event, func(ctx context.Context) (int64, error) {
+		selectErr := database.Reader().SelectContext(ctx, dest, query, args...)
+		return sliceLen(dest), selectErr
+	})
 }
 func Select(dest interface{}, query string, args ...interface{}) error {
 	return SelectFor(DefaultName, dest, query, args...)
 }
 
 func ExecContextFor(ctx context.Context, dbName string, query string, args ...any) (sql.Result, error) {
-	sqlMutex.RLock()
-	sqlxdb, exists := sqlMap[dbName]
-	sqlMutex.RUnlock()
-	if !exists {
-		return nil, fmt.Errorf("database not initialized")
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return nil, err
 	}
-	return sqlxdb.ExecContext(ctx, query, args...)
+	var result sql.Result
+	event := &QueryEvent{Operation: OperationExec, Query: query, Args: args}
+	err = observe(ctx, database, event, func(ctx context.Context) (int64, error) {
+		var execErr error
+		result, execErr = database.Primary().ExecContext(ctx, query, args...)
+		return rowsAffected(result), execErr
+	})
+	return result, err
 }
 func ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
 	return ExecContextFor(ctx, DefaultName, query, args...)
 }
 
 func NewTranscationFor(dbName string) (*SqlxTransaction, error) {
-	sqlMutex.RLock()
-	sqlxdb, exists := sqlMap[dbName]
-	sqlMutex.RUnlock()
-	if !exists {
-		return nil, fmt.Errorf("database not initialized")
+	database, err := GetDatabase(dbName)
+	if err != nil {
+		return nil, err
 	}
-	tx, err := sqlxdb.Beginx()
+	var tx *sqlx.Tx
+	event := &QueryEvent{Operation: OperationBegin, InTx: true}
+	err = observe(context.Background(), database, event, func(ctx context.Context) (int64, error) {
+		var beginErr error
+		tx, beginErr = database.Primary().Beginx()
+		return 0, beginErr
+	})
 	if err != nil {
 		return nil, fmt.Errorf("beginx: %w", err)
 	}
-	return NewSqlxTransaction(tx), nil
+	return &SqlxTransaction{tx: tx, database: database}, nil
 }
 func NewTranscation() (*SqlxTransaction, error) {
 	return NewTranscationFor(DefaultName)
 }
 
 type SqlxTransaction struct {
-	tx *sqlx.Tx
+	tx          *sqlx.Tx
+	database    *Database
+	afterCommit []func()
 }
 
 func NewSqlxTransaction(tx *sqlx.Tx) *SqlxTransaction {
@@ -129,13 +264,73 @@ func NewSqlxTransaction(tx *sqlx.Tx) *SqlxTransaction {
 }
 
 func (t *SqlxTransaction) Commit() error {
-	return t.tx.Commit()
+	event := &QueryEvent{Operation: OperationCommit, InTx: true}
+	err := observe(context.Background(), t.database, event, func(ctx context.Context) (int64, error) {
+		return 0, t.tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+	for _, fn := range t.afterCommit {
+		fn()
+	}
+	t.afterCommit = nil
+	return nil
+}
+
+// AfterCommit 注册事务提交成功后执行的函数，例如清理缓存。事务回滚时不会执行
+func (t *SqlxTransaction) AfterCommit(fn func()) {
+	t.afterCommit = append(t.afterCommit, fn)
 }
 
 func (t *SqlxTransaction) Rollback() error {
-	return t.tx.Rollback()
+	event := &QueryEvent{Operation: OperationRollback, InTx: true}
+	t.afterCommit = nil
+	return observe(context.Background(), t.database, event, func(ctx context.Context) (int64, error) {
+		return 0, t.tx.Rollback()
+	})
 }
 
 func (t *SqlxTransaction) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
-	return t.tx.NamedQuery(query, arg)
+	var rows *sqlx.Rows
+	event := &QueryEvent{Operation: OperationQuery, Query: query, Args: arg, InTx: true}
+	err := observe(context.Background(), t.database, event, func(ctx context.Context) (int64, error) {
+		var queryErr error
+		rows, queryErr = t.tx.NamedQuery(query, arg)
+		return -1, queryErr
+	})
+	return rows, err
+}
+
+func (t *SqlxTransaction) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	var result sql.Result
+	event := &QueryEvent{Operation: OperationExec, Query: query, Args: arg, InTx: true}
+	err := observe(context.Background(), t.database, event, func(ctx context.Context) (int64, error) {
+		var execErr error
+		result, execErr = t.tx.NamedExec(query, arg)
+		return rowsAffected(result), execErr
+	})
+	return result, err
+}
+
+func rowsAffected(result sql.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return count
+}
+
+func sliceLen(dest interface{}) int64 {
+	value := reflect.ValueOf(dest)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice {
+		return -1
+	}
+	return int64(value.Len())
 }
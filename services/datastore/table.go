@@ -100,7 +100,7 @@ func (m *DataRow) InnerMap() map[string]interface{} {
 }
 
 func (m *DataRow) getValue(key string) (interface{}, bool) {
-	if m.dataMap != nil {
+	if m.dataMap == nil {
 		return nil, false
 	}
 	if v, ok := m.dataMap[key]; ok {
@@ -120,7 +120,7 @@ func (m *DataRow) MustGetInt(key string) int {
 func (m *DataRow) TryGetInt(key string) (int, error) {
 	v, ok := m.dataMap[key]
 	if !ok {
-		return 0, fmt.Errorf("TryGetInt error, not found key: %s", key)
+		return 0, fmt.Errorf("TryGetInt error, %w key: %s", models.ErrNotFound, key)
 	}
 	intVal, err := convert.ConvertInt(v)
 	if err != nil {
@@ -182,7 +182,7 @@ func (m *DataRow) SetIntDefaultChainFrom(key string, getter IntGetter, defaultVa
 func (m *DataRow) TryGetString(key string) (string, error) {
 	v, ok := m.dataMap[key]
 	if !ok {
-		return "", fmt.Errorf("TryGetInt error, %w key: %s", models.ErrNotFound, key)
+		return "", fmt.Errorf("TryGetString error, %w key: %s", models.ErrNotFound, key)
 	}
 	strVal, err := convert.ConvertString(v)
 	if err != nil {
@@ -308,7 +308,7 @@ func (m *DataRow) SetNullUuidStringChain(key string, uuidString string) *DataRow
 func (m *DataRow) TryGetTime(key string) (time.Time, error) {
 	v, ok := m.dataMap[key]
 	if !ok {
-		return time.Time{}, fmt.Errorf("TryGetTime error, not found key: %s", key)
+		return time.Time{}, fmt.Errorf("TryGetTime error, %w key: %s", models.ErrNotFound, key)
 	}
 	timeVal, err := convert.ConvertTime(v)
 	if err != nil {
@@ -0,0 +1,274 @@
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/models"
+	"github.com/pnnh/neutron/services/convert"
+)
+
+// FieldError 读取某个键时发生的错误
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("key: %s, error: %v", e.Key, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// lookup 读取键对应的值，键不存在时返回 models.ErrNotFound，值为nil时返回 models.ErrNilValue
+func (m *DataRow) lookup(key string) (interface{}, error) {
+	v, ok := m.getValue(key)
+	if !ok {
+		return nil, fmt.Errorf("%w key: %s", models.ErrNotFound, key)
+	}
+	if v == nil {
+		return nil, fmt.Errorf("%w key: %s", models.ErrNilValue, key)
+	}
+	return v, nil
+}
+
+func (m *DataRow) TryGetInt64(key string) (int64, error) {
+	v, err := m.lookup(key)
+	if err != nil {
+		return 0, fmt.Errorf("TryGetInt64 error, %w", err)
+	}
+	intVal, err := toInt64(v)
+	if err != nil {
+		return 0, fmt.Errorf("TryGetInt64 error, key: %s, value: %v, error: %w", key, v, err)
+	}
+	return intVal, nil
+}
+
+func (m *DataRow) TryGetBool(key string) (bool, error) {
+	v, err := m.lookup(key)
+	if err != nil {
+		return false, fmt.Errorf("TryGetBool error, %w", err)
+	}
+	boolVal, err := toBool(v)
+	if err != nil {
+		return false, fmt.Errorf("TryGetBool error, key: %s, value: %v, error: %w", key, v, err)
+	}
+	return boolVal, nil
+}
+
+func (m *DataRow) TryGetFloat64(key string) (float64, error) {
+	v, err := m.lookup(key)
+	if err != nil {
+		return 0, fmt.Errorf("TryGetFloat64 error, %w", err)
+	}
+	floatVal, err := toFloat64(v)
+	if err != nil {
+		return 0, fmt.Errorf("TryGetFloat64 error, key: %s, value: %v, error: %w", key, v, err)
+	}
+	return floatVal, nil
+}
+
+// TryGetDecimal 以字符串形式返回numeric/decimal列的精确值，避免转换为浮点数时损失精度
+func (m *DataRow) TryGetDecimal(key string) (string, error) {
+	v, err := m.lookup(key)
+	if err != nil {
+		return "", fmt.Errorf("TryGetDecimal error, %w", err)
+	}
+	var text string
+	switch value := normalizeText(v).(type) {
+	case string:
+		text = strings.TrimSpace(value)
+	case float32, float64:
+		text = fmt.Sprintf("%v", value)
+	default:
+		intVal, intErr := toInt64(value)
+		if intErr != nil {
+			return "", fmt.Errorf("TryGetDecimal error, key: %s, value: %v, error: %w", key, v, intErr)
+		}
+		text = fmt.Sprintf("%d", intVal)
+	}
+	if _, ok := new(big.Rat).SetString(text); !ok {
+		return "", fmt.Errorf("TryGetDecimal error, key: %s, value: %v, invalid decimal", key, v)
+	}
+	return text, nil
+}
+
+func (m *DataRow) TryGetBytes(key string) ([]byte, error) {
+	v, err := m.lookup(key)
+	if err != nil {
+		return nil, fmt.Errorf("TryGetBytes error, %w", err)
+	}
+	switch value := v.(type) {
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("TryGetBytes error, key: %s, unsupported type %T", key, v)
+}
+
+func (m *DataRow) TryGetUuid(key string) (uuid.UUID, error) {
+	v, err := m.lookup(key)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("TryGetUuid error, %w", err)
+	}
+	var id uuid.UUID
+	if value, ok := v.(uuid.UUID); ok {
+		return value, nil
+	}
+	if err := id.Scan(v); err != nil {
+		return uuid.Nil, fmt.Errorf("TryGetUuid error, key: %s, value: %v, error: %w", key, v, err)
+	}
+	return id, nil
+}
+
+// TryGetJSON 把JSON/JSONB列解码到dest中，dest必须是指针
+func (m *DataRow) TryGetJSON(key string, dest any) error {
+	v, err := m.lookup(key)
+	if err != nil {
+		return fmt.Errorf("TryGetJSON error, %w", err)
+	}
+	text, ok := textOf(v)
+	if !ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("TryGetJSON error, key: %s, error: %w", key, err)
+		}
+		text = string(data)
+	}
+	if err := json.Unmarshal([]byte(text), dest); err != nil {
+		return fmt.Errorf("TryGetJSON error, key: %s, error: %w", key, err)
+	}
+	return nil
+}
+
+// RowReader 连续读取 DataRow 的多个字段，转换失败时返回零值，并把错误连同键名累积起来，
+// 读取完成后统一检查 Err。累积的错误不会写入 DataRow.Err，不影响之后的 Set*ChainFrom 调用，例如：
+//
+//	reader := row.Reader()
+//	name := reader.GetString("name")
+//	age := reader.GetInt("age")
+//	if err := reader.Err(); err != nil { ... }
+type RowReader struct {
+	row         *DataRow
+	fieldErrors []*FieldError
+}
+
+// Reader 返回读取该行的 RowReader
+func (m *DataRow) Reader() *RowReader {
+	return &RowReader{row: m}
+}
+
+// Err 返回所有读取失败的字段错误，没有错误时返回nil
+func (r *RowReader) Err() error {
+	errs := make([]error, 0, len(r.fieldErrors))
+	for _, fieldErr := range r.fieldErrors {
+		errs = append(errs, fieldErr)
+	}
+	return errors.Join(errs...)
+}
+
+// FieldErrors 按读取顺序返回每个失败的键及其错误
+func (r *RowReader) FieldErrors() []*FieldError {
+	return r.fieldErrors
+}
+
+func (r *RowReader) addFieldError(key string, err error) {
+	r.fieldErrors = append(r.fieldErrors, &FieldError{Key: key, Err: err})
+}
+
+func readField[T any](r *RowReader, key string, getter func(string) (T, error)) T {
+	value, err := getter(key)
+	if err != nil {
+		r.addFieldError(key, err)
+		var zero T
+		return zero
+	}
+	return value
+}
+
+func (r *RowReader) GetInt(key string) int {
+	return readField(r, key, r.row.TryGetInt)
+}
+
+func (r *RowReader) GetInt64(key string) int64 {
+	return readField(r, key, r.row.TryGetInt64)
+}
+
+func (r *RowReader) GetString(key string) string {
+	return readField(r, key, r.row.TryGetString)
+}
+
+func (r *RowReader) GetTime(key string) time.Time {
+	return readField(r, key, r.row.TryGetTime)
+}
+
+func (r *RowReader) GetBool(key string) bool {
+	return readField(r, key, r.row.TryGetBool)
+}
+
+func (r *RowReader) GetFloat64(key string) float64 {
+	return readField(r, key, r.row.TryGetFloat64)
+}
+
+func (r *RowReader) GetDecimal(key string) string {
+	return readField(r, key, r.row.TryGetDecimal)
+}
+
+func (r *RowReader) GetBytes(key string) []byte {
+	return readField(r, key, r.row.TryGetBytes)
+}
+
+func (r *RowReader) GetUuid(key string) uuid.UUID {
+	return readField(r, key, r.row.TryGetUuid)
+}
+
+func (r *RowReader) GetJSON(key string, dest any) {
+	if err := r.row.TryGetJSON(key, dest); err != nil {
+		r.addFieldError(key, err)
+	}
+}
+
+// GetNullString 值为nil时返回无效的sql.NullString，不记录错误
+func (r *RowReader) GetNullString(key string) sql.NullString {
+	v, err := r.row.lookup(key)
+	if models.IsErrNilValue(err) {
+		return sql.NullString{}
+	}
+	if err != nil {
+		r.addFieldError(key, err)
+		return sql.NullString{}
+	}
+	strVal, err := convert.ToString(v)
+	if err != nil {
+		r.addFieldError(key, err)
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strVal, Valid: true}
+}
+
+// GetNullTime 值为nil时返回无效的sql.NullTime，不记录错误
+func (r *RowReader) GetNullTime(key string) sql.NullTime {
+	v, err := r.row.lookup(key)
+	if models.IsErrNilValue(err) {
+		return sql.NullTime{}
+	}
+	if err != nil {
+		r.addFieldError(key, err)
+		return sql.NullTime{}
+	}
+	timeVal, err := convert.ConvertTime(normalizeText(v))
+	if err != nil {
+		r.addFieldError(key, err)
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: timeVal, Valid: true}
+}
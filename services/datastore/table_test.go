@@ -0,0 +1,96 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/models"
+)
+
+func TestDataRowTryGet(t *testing.T) {
+	owner := uuid.New()
+	row := MapToDataRow(map[string]any{
+		"count":    int64(42),
+		"active":   []byte("t"),
+		"score":    []byte("9.5"),
+		"amount":   []byte("12345678901234567890.01"),
+		"payload":  []byte{1, 2, 3},
+		"owner":    owner.String(),
+		"metadata": []byte(`{"lang":"go"}`),
+		"empty":    nil,
+	})
+
+	if v, err := row.TryGetInt64("count"); err != nil || v != 42 {
+		t.Fatalf("TryGetInt64 = %v, %v", v, err)
+	}
+	if v, err := row.TryGetBool("active"); err != nil || !v {
+		t.Fatalf("TryGetBool = %v, %v", v, err)
+	}
+	if v, err := row.TryGetFloat64("score"); err != nil || v != 9.5 {
+		t.Fatalf("TryGetFloat64 = %v, %v", v, err)
+	}
+	if v, err := row.TryGetDecimal("amount"); err != nil || v != "12345678901234567890.01" {
+		t.Fatalf("TryGetDecimal = %v, %v", v, err)
+	}
+	if v, err := row.TryGetBytes("payload"); err != nil || len(v) != 3 {
+		t.Fatalf("TryGetBytes = %v, %v", v, err)
+	}
+	if v, err := row.TryGetUuid("owner"); err != nil || v != owner {
+		t.Fatalf("TryGetUuid = %v, %v", v, err)
+	}
+	var metadata map[string]string
+	if err := row.TryGetJSON("metadata", &metadata); err != nil || metadata["lang"] != "go" {
+		t.Fatalf("TryGetJSON = %v, %v", metadata, err)
+	}
+
+	if _, err := row.TryGetInt64("missing"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("missing key error = %v", err)
+	}
+	if _, err := row.TryGetBool("empty"); !models.IsErrNilValue(err) {
+		t.Fatalf("nil value error = %v", err)
+	}
+	if _, err := row.TryGetDecimal("active"); err == nil {
+		t.Fatalf("expected invalid decimal error")
+	}
+}
+
+func TestDataRowReader(t *testing.T) {
+	row := MapToDataRow(map[string]any{
+		"name":       "alice",
+		"age":        "not a number",
+		"login_time": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"nickname":   nil,
+	})
+
+	reader := row.Reader()
+	name := reader.GetString("name")
+	age := reader.GetInt("age")
+	loginTime := reader.GetTime("login_time")
+	nickname := reader.GetNullString("nickname")
+	active := reader.GetBool("active")
+
+	if name != "alice" || age != 0 || loginTime.Year() != 2024 || nickname.Valid || active {
+		t.Fatalf("unexpected values: %v %v %v %v %v", name, age, loginTime, nickname, active)
+	}
+	if reader.Err() == nil {
+		t.Fatalf("expected accumulated error")
+	}
+	fieldErrors := reader.FieldErrors()
+	if len(fieldErrors) != 2 || fieldErrors[0].Key != "age" || fieldErrors[1].Key != "active" {
+		t.Fatalf("unexpected field errors: %v", reader.Err())
+	}
+	if !errors.Is(reader.Err(), models.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound in %v", reader.Err())
+	}
+
+	// 读取失败不影响行本身的链式调用
+	if row.Err != nil {
+		t.Fatalf("row.Err = %v, want nil", row.Err)
+	}
+	source := MapToDataRow(map[string]any{"count": 3})
+	if row.SetIntChainFrom("count", source); row.Err != nil || row.GetInt("count") != 3 {
+		t.Fatalf("SetIntChainFrom after failed read: %v", row.Err)
+	}
+}
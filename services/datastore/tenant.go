@@ -0,0 +1,172 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrTenantRequired = errors.New("tenant id required")
+	ErrTenantMismatch = errors.New("tenant id mismatch")
+)
+
+type tenantKey struct{}
+
+// WithTenant 返回携带租户ID的ctx，通过 Table.WithContext 传给表后，查询和写入都限定在该租户内。
+// 多租户有两种方式，可以同时使用：
+//
+//   - 共享表：模型中用 datastore:"tenant" 标签声明租户列，查询自动附加租户条件，插入时自动填充租户列
+//   - 独立schema（仅PostgreSQL）：通过 SetTenantSchemaFor 开启，每次调用都在事务中把search_path切换到租户的schema
+//
+// 需要跨租户查询时显式调用 Table.AllTenants
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+func TenantFrom(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+var (
+	tenantSchemaMap   = make(map[string]func(tenantID string) string)
+	tenantSchemaMutex = sync.RWMutex{}
+)
+
+// SetTenantSchemaFor 为数据库开启schema-per-tenant模式，schema把租户ID映射为schema名称，为nil时关闭。
+// search_path会被设置为租户的schema和public，共享的表（例如审计表）可以放在public中
+func SetTenantSchemaFor(dbName string, schema func(tenantID string) string) {
+	tenantSchemaMutex.Lock()
+	defer tenantSchemaMutex.Unlock()
+	if schema == nil {
+		delete(tenantSchemaMap, dbName)
+		return
+	}
+	tenantSchemaMap[dbName] = schema
+}
+
+func tenantSchemaFor(dbName string) func(tenantID string) string {
+	tenantSchemaMutex.RLock()
+	defer tenantSchemaMutex.RUnlock()
+	return tenantSchemaMap[dbName]
+}
+
+// AllTenants 返回一个不做租户隔离的表副本，用于管理后台等需要跨租户读写的场景
+func (m *Table[T, M]) AllTenants() *Table[T, M] {
+	table := *m
+	table.allTenants = true
+	return &table
+}
+
+// tenant 返回当前的租户ID，跨租户模式下返回空
+func (m *Table[T, M]) tenant() (string, error) {
+	if m.allTenants {
+		return "", nil
+	}
+	tenantID, ok := TenantFrom(m.context())
+	if !ok {
+		return "", fmt.Errorf("table %s: %w", m.TableName, ErrTenantRequired)
+	}
+	return tenantID, nil
+}
+
+// tenantFilter 租户列的过滤条件，模型没有租户列或处于跨租户模式时返回空
+func (m *Table[T, M]) tenantFilter(params map[string]any) (string, error) {
+	field := conventionsOf[M]().tenant
+	if field == nil || m.allTenants {
+		return "", nil
+	}
+	tenantID, err := m.tenant()
+	if err != nil {
+		return "", err
+	}
+	params[tenantParam] = tenantID
+	return fmt.Sprintf("%s = :%s", field.column, tenantParam), nil
+}
+
+// fillTenant 插入前填充模型的租户列，已有的值必须与当前租户一致
+func (m *Table[T, M]) fillTenant(value reflect.Value) error {
+	field := conventionsOf[M]().tenant
+	if field == nil || m.allTenants {
+		return nil
+	}
+	tenantID, err := m.tenant()
+	if err != nil {
+		return err
+	}
+	target := value.FieldByIndex(field.index)
+	if target.Kind() != reflect.String {
+		return fmt.Errorf("tenant field %s must be a string", field.column)
+	}
+	if current := target.String(); current != "" && current != tenantID {
+		return fmt.Errorf("table %s: %w", m.TableName, ErrTenantMismatch)
+	}
+	target.SetString(tenantID)
+	return nil
+}
+
+// tenantScoped 表的读写是否限定在某个租户内
+func (m *Table[T, M]) tenantScoped() bool {
+	if m.allTenants {
+		return false
+	}
+	return conventionsOf[M]().tenant != nil || tenantSchemaFor(m.Database()) != nil
+}
+
+// needTenantSchema 数据库开启了schema-per-tenant模式，且本次调用还没有切换search_path
+func (m *Table[T, M]) needTenantSchema() bool {
+	return !m.schemaApplied && !m.allTenants && tenantSchemaFor(m.Database()) != nil
+}
+
+// inTenantSchema 在切换了search_path的事务中执行fn，表本身不在事务中时自动开启并提交事务
+func inTenantSchema[T ITable[M], M any, V any](m *Table[T, M], fn func(t *Table[T, M]) (V, error)) (result V, resultErr error) {
+	dialect, err := m.dialect()
+	if err != nil {
+		return result, fmt.Errorf("dialect: %w", err)
+	}
+	if dialect.Name() != DialectPostgres {
+		return result, fmt.Errorf("tenant schema is not supported by dialect %s", dialect.Name())
+	}
+	tenantID, err := m.tenant()
+	if err != nil {
+		return result, err
+	}
+	schema := tenantSchemaFor(m.Database())(tenantID)
+	if !IsValidTableName(schema) {
+		return result, fmt.Errorf("invalid tenant schema: %s", schema)
+	}
+	table := *m
+	table.schemaApplied = true
+	if table.tx == nil {
+		tx, err := NewTranscationFor(m.Database())
+		if err != nil {
+			return result, err
+		}
+		defer func() {
+			if resultErr != nil {
+				_ = tx.Rollback()
+				return
+			}
+			resultErr = tx.Commit()
+		}()
+		table.tx = tx
+	}
+	sqlParams := map[string]any{"search_path": dialect.Quote(schema) + ", public"}
+	if _, err := table.tx.NamedExec(`select set_config('search_path', :search_path, true);`, sqlParams); err != nil {
+		return result, fmt.Errorf("set search_path: %w", err)
+	}
+	return fn(&table)
+}
+
+func inTenantSchemaExec[T ITable[M], M any](m *Table[T, M], fn func(t *Table[T, M]) error) error {
+	_, err := inTenantSchema(m, func(t *Table[T, M]) (struct{}, error) {
+		return struct{}{}, fn(t)
+	})
+	return err
+}
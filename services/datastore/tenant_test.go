@@ -0,0 +1,78 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type tenantNoteModel struct {
+	Pk       string `db:"pk"`
+	TenantId string `db:"tenant_id" datastore:"tenant"`
+	Title    string `db:"title"`
+}
+
+type tenantNoteSchema struct{}
+
+func (s tenantNoteSchema) GetConditions() []ModelCondition {
+	return nil
+}
+
+func TestTableTenant(t *testing.T) {
+	dbName := "tenant_sqlite"
+	initSqliteForTest(t, dbName)
+	_, err := NamedExecFor(dbName, `create table tenant_notes (pk text, tenant_id text, title text,
+primary key (tenant_id, pk))`, map[string]any{})
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	table := NewTable[tenantNoteSchema, tenantNoteModel]("tenant_notes", tenantNoteSchema{})
+	table.SetDatabase(dbName)
+	if _, err := table.Count(); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("Count() without tenant = %v, want ErrTenantRequired", err)
+	}
+	acme := table.WithContext(WithTenant(context.Background(), "acme"))
+	globex := table.WithContext(WithTenant(context.Background(), "globex"))
+
+	note := &tenantNoteModel{Pk: "a", Title: "acme note"}
+	if err := acme.Insert(note); err != nil || note.TenantId != "acme" {
+		t.Fatalf("Insert() = %v, tenant %q", err, note.TenantId)
+	}
+	if err := globex.Insert(&tenantNoteModel{Pk: "a", Title: "globex note"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := acme.Insert(&tenantNoteModel{Pk: "b", TenantId: "globex"}); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("Insert() into other tenant = %v, want ErrTenantMismatch", err)
+	}
+
+	if got, err := globex.Get("a"); err != nil || got.Title != "globex note" {
+		t.Fatalf("Get() = %+v, %v", got, err)
+	}
+	if err := globex.Update(&tenantNoteModel{Pk: "a", TenantId: "acme", Title: "moved"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, _ := acme.Get("a"); got.Title != "acme note" {
+		t.Fatalf("Update() changed another tenant's row: %+v", got)
+	}
+	if err := globex.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := globex.Delete("a"); err == nil {
+		t.Fatalf("Delete() twice succeeded")
+	}
+
+	if count, err := acme.Count(); err != nil || count != 1 {
+		t.Fatalf("Count() = %d, %v, want 1", count, err)
+	}
+	if count, err := table.AllTenants().Count(); err != nil || count != 1 {
+		t.Fatalf("AllTenants().Count() = %d, %v, want 1", count, err)
+	}
+	if err := table.AllTenants().Insert(&tenantNoteModel{Pk: "c", TenantId: "initech"}); err != nil {
+		t.Fatalf("AllTenants().Insert: %v", err)
+	}
+	notes, err := table.AllTenants().Select(0, 10)
+	if err != nil || len(notes) != 2 {
+		t.Fatalf("AllTenants().Select() = %+v, %v", notes, err)
+	}
+}
@@ -1,37 +1,70 @@
 package email
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"sync"
 
 	"github.com/pnnh/neutron/config"
-	"golang.org/x/time/rate"
-
-	gomail "gopkg.in/gomail.v2"
 )
 
-var dialer *gomail.Dialer
-var limiter *rate.Limiter = &rate.Limiter{}
+var ErrMailerNotInitialized = errors.New("mailer not initialized")
+
+var (
+	defaultMailer *Mailer
+	mailerMutex   = sync.RWMutex{}
+)
 
+// InitMail 按MAIL_HOST、MAIL_PORT、MAIL_USER、MAIL_PASSWORD配置创建默认的Mailer，每秒最多发送1封邮件。
+// 新的代码建议通过 NewMailer 显式创建
 func InitMail() {
 	mailHost := config.MustGetConfigurationString("MAIL_HOST")
 	mailPort := config.GetConfigOrDefaultInt64("MAIL_PORT", 587)
 	mailUser := config.MustGetConfigurationString("MAIL_USER")
 	mailPassword := config.MustGetConfigurationString("MAIL_PASSWORD")
-	d := gomail.NewDialer(mailHost, int(mailPort), mailUser, mailPassword)
-	dialer = d
+	transport := NewSMTPTransport(SMTPConfig{
+		Host:     mailHost,
+		Port:     int(mailPort),
+		Username: mailUser,
+		Password: mailPassword,
+	})
+	SetDefaultMailer(NewMailer(transport, MailerConfig{}))
+}
 
-	limiter = rate.NewLimiter(1, 1)
+// SetDefaultMailer 设置 SendMail、Send 和 SendTemplate 使用的Mailer，例如测试中使用 MemoryTransport
+func SetDefaultMailer(mailer *Mailer) {
+	mailerMutex.Lock()
+	defer mailerMutex.Unlock()
+	defaultMailer = mailer
+}
+
+func DefaultMailer() (*Mailer, error) {
+	mailerMutex.RLock()
+	defer mailerMutex.RUnlock()
+	if defaultMailer == nil {
+		return nil, ErrMailerNotInitialized
+	}
+	return defaultMailer, nil
 }
 
 func SendMail(from, subject, mailBody string, to ...string) error {
-	if !limiter.Allow() {
-		return fmt.Errorf("邮件发送频率过高")
+	return Send(&Message{From: from, To: to, Subject: subject, HTML: mailBody})
+}
+
+// Send 通过默认的Mailer发送一封邮件，超过发送频率时等待
+func Send(message *Message) error {
+	mailer, err := DefaultMailer()
+	if err != nil {
+		return err
 	}
-	m := gomail.NewMessage()
-	m.SetHeader("From", from)
-	m.SetHeader("To", to...)
-	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", mailBody)
+	return mailer.Send(context.Background(), message)
+}
 
-	return dialer.DialAndSend(m)
+// SendTemplate 通过默认的Mailer渲染模板并发送，参考 Mailer.SendTemplate
+func SendTemplate(templates *Templates, name, lang string, data any, message *Message) error {
+	mailer, err := DefaultMailer()
+	if err != nil {
+		return err
+	}
+	return mailer.SendTemplate(context.Background(), templates, name, lang, data, message)
 }
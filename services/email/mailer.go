@@ -0,0 +1,82 @@
+package email
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// MailerConfig 发信配置
+type MailerConfig struct {
+	// From 默认发件人，邮件没有指定发件人时使用
+	From string
+	// Rate 每秒最多发送的邮件数，为0时使用默认值1，小于0时不限制
+	Rate float64
+	// Burst 允许连续发送的邮件数，默认为1
+	Burst int
+}
+
+// Mailer 通过Transport发送邮件，超过发送频率时等待而不是返回错误
+type Mailer struct {
+	transport Transport
+	from      string
+	limiter   *rate.Limiter
+}
+
+func NewMailer(transport Transport, config MailerConfig) *Mailer {
+	limit := rate.Limit(config.Rate)
+	if config.Rate == 0 {
+		limit = 1
+	} else if config.Rate < 0 {
+		limit = rate.Inf
+	}
+	burst := config.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+	return &Mailer{
+		transport: transport,
+		from:      config.From,
+		limiter:   rate.NewLimiter(limit, burst),
+	}
+}
+
+// Send 发送一封邮件，等待发送配额时ctx结束则返回ctx的错误。message不会被修改
+func (m *Mailer) Send(ctx context.Context, message *Message) error {
+	outgoing, err := m.prepare(message)
+	if err != nil {
+		return err
+	}
+	if err := m.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("email: wait for rate limiter: %w", err)
+	}
+	return m.transport.Send(ctx, outgoing)
+}
+
+// prepare 返回填充了默认发件人并校验过的副本
+func (m *Mailer) prepare(message *Message) (*Message, error) {
+	outgoing := *message
+	if outgoing.From == "" {
+		outgoing.From = m.from
+	}
+	if err := outgoing.Validate(); err != nil {
+		return nil, err
+	}
+	return &outgoing, nil
+}
+
+// SendTemplate 渲染模板并发送，message提供发件人和收件人等信息，主题为空时使用模板渲染的主题
+func (m *Mailer) SendTemplate(ctx context.Context, templates *Templates, name, lang string, data any, message *Message) error {
+	rendered, err := templates.Render(name, lang, data)
+	if err != nil {
+		return err
+	}
+	outgoing := *message
+	if outgoing.Subject == "" {
+		outgoing.Subject = rendered.Subject
+	}
+	outgoing.Text = rendered.Text
+	outgoing.HTML = rendered.HTML
+	return m.Send(ctx, &outgoing)
+}
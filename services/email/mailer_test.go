@@ -0,0 +1,84 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pnnh/neutron/models"
+)
+
+func TestMailer(t *testing.T) {
+	transport := NewMemoryTransport()
+	mailer := NewMailer(transport, MailerConfig{From: "noreply@example.com", Rate: 50})
+	ctx := context.Background()
+
+	// 超过频率时等待而不是返回错误
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := mailer.Send(ctx, &Message{To: []string{"alice@example.com"}, Subject: "hi", Text: "hello"}); err != nil {
+			t.Fatalf("Send #%d: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("3 sends at 50/s took %v, limiter did not wait", elapsed)
+	}
+	messages := transport.Messages()
+	if len(messages) != 3 || messages[0].From != "noreply@example.com" {
+		t.Fatalf("Messages() = %+v", messages)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := mailer.Send(cancelled, &Message{To: []string{"alice@example.com"}, Text: "x"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send() with cancelled ctx = %v", err)
+	}
+	if err := mailer.Send(ctx, &Message{Text: "x"}); err == nil {
+		t.Fatalf("Send() without recipients succeeded")
+	}
+
+	templates, err := ParseTemplates(testTemplates, "mail")
+	if err != nil {
+		t.Fatalf("ParseTemplates: %v", err)
+	}
+	transport.Reset()
+	message := &Message{To: []string{"alice@example.com"}}
+	if err := mailer.SendTemplate(ctx, templates, "welcome", models.LangZh, welcomeData{Name: "Alice"}, message); err != nil {
+		t.Fatalf("SendTemplate: %v", err)
+	}
+	if sent := transport.Messages(); len(sent) != 1 || sent[0].Subject != "欢迎，Alice" || sent[0].HTML == "" {
+		t.Fatalf("SendTemplate sent %+v", sent)
+	}
+	if message.Subject != "" || message.From != "" {
+		t.Fatalf("SendTemplate modified the message: %+v", message)
+	}
+}
+
+func TestFileTransport(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewFileTransport(dir)
+	if err != nil {
+		t.Fatalf("NewFileTransport: %v", err)
+	}
+	mailer := NewMailer(transport, MailerConfig{From: "noreply@example.com", Rate: -1})
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), &Message{To: []string{"alice@example.com"}, Subject: "dev", Text: "body"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("maildir new = %v, %v", files, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	if err != nil || !strings.Contains(string(data), "Subject: dev") {
+		t.Fatalf("mail file = %s, %v", data, err)
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Fatalf("maildir tmp is not empty")
+	}
+}
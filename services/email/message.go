@@ -0,0 +1,125 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+
+	gomail "gopkg.in/gomail.v2"
+)
+
+var ErrInvalidMessage = errors.New("invalid email message")
+
+// Attachment 邮件附件，Inline为true时作为内嵌资源，HTML中通过 cid:<Filename> 引用，例如 <img src="cid:logo.png">
+type Attachment struct {
+	Filename string
+	// ContentType 为空时按文件扩展名推断
+	ContentType string
+	Data        []byte
+	Inline      bool
+}
+
+// Message 一封邮件，Text和HTML同时存在时作为multipart/alternative发送，收件端选择能显示的版本
+type Message struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+	// Headers 附加的邮件头，例如 List-Unsubscribe
+	Headers map[string]string
+}
+
+// Attach 添加附件
+func (m *Message) Attach(filename, contentType string, data []byte) {
+	m.Attachments = append(m.Attachments, Attachment{Filename: filename, ContentType: contentType, Data: data})
+}
+
+// Embed 添加内嵌资源，HTML中通过 cid:<filename> 引用
+func (m *Message) Embed(filename, contentType string, data []byte) {
+	m.Attachments = append(m.Attachments, Attachment{Filename: filename, ContentType: contentType, Data: data, Inline: true})
+}
+
+// Validate 检查发件人、收件人和正文
+func (m *Message) Validate() error {
+	if m.From == "" {
+		return fmt.Errorf("%w: missing sender", ErrInvalidMessage)
+	}
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return fmt.Errorf("%w: missing recipients", ErrInvalidMessage)
+	}
+	if m.Text == "" && m.HTML == "" {
+		return fmt.Errorf("%w: missing body", ErrInvalidMessage)
+	}
+	return nil
+}
+
+// Recipients 返回所有收件人，包括抄送和密送
+func (m *Message) Recipients() []string {
+	recipients := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	recipients = append(recipients, m.To...)
+	recipients = append(recipients, m.Cc...)
+	return append(recipients, m.Bcc...)
+}
+
+// gomailMessage 转换为gomail的邮件，Bcc只用于投递，不会出现在邮件头中
+func (m *Message) gomailMessage() *gomail.Message {
+	message := gomail.NewMessage()
+	message.SetHeader("From", m.From)
+	if len(m.To) > 0 {
+		message.SetHeader("To", m.To...)
+	}
+	if len(m.Cc) > 0 {
+		message.SetHeader("Cc", m.Cc...)
+	}
+	if len(m.Bcc) > 0 {
+		message.SetHeader("Bcc", m.Bcc...)
+	}
+	if m.ReplyTo != "" {
+		message.SetHeader("Reply-To", m.ReplyTo)
+	}
+	message.SetHeader("Subject", m.Subject)
+	for name, value := range m.Headers {
+		message.SetHeader(name, value)
+	}
+
+	switch {
+	case m.Text != "" && m.HTML != "":
+		message.SetBody("text/plain", m.Text)
+		message.AddAlternative("text/html", m.HTML)
+	case m.HTML != "":
+		message.SetBody("text/html", m.HTML)
+	default:
+		message.SetBody("text/plain", m.Text)
+	}
+
+	for _, attachment := range m.Attachments {
+		data := attachment.Data
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		settings := []gomail.FileSetting{
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}),
+			gomail.SetHeader(map[string][]string{"Content-Type": {contentType}}),
+		}
+		if attachment.Inline {
+			message.Embed(attachment.Filename, settings...)
+		} else {
+			message.Attach(attachment.Filename, settings...)
+		}
+	}
+	return message
+}
@@ -0,0 +1,174 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/pnnh/neutron/services/jobs"
+	"github.com/redis/go-redis/v9"
+)
+
+// OutboxJobName 发件箱在 jobs.Manager 中注册的任务名称
+const OutboxJobName = "email.outbox.deliver"
+
+// 邮件的投递状态，DeliverySent和DeliveryFailed是最终状态
+const (
+	DeliveryQueued   = "queued"
+	DeliverySending  = "sending"
+	DeliveryRetrying = "retrying"
+	DeliverySent     = "sent"
+	DeliveryFailed   = "failed"
+)
+
+// Delivery 一封邮件的投递状态
+type Delivery struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	// Attempts 已经尝试发送的次数
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// NextAttempt 等待重试时下一次发送的时间
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	UpdateTime  time.Time `json:"update_time"`
+}
+
+// OutboxOptions 发件箱配置，零值字段使用默认值
+type OutboxOptions struct {
+	// Queue 投递使用的任务队列，需要在 jobs.Options.Queues 中配置，默认为 jobs.DefaultQueue
+	Queue string
+	// Prefix 去重标记的Redis键前缀，默认为 neutron:email:outbox:
+	Prefix string
+	// DedupTTL 消息键的保留时间，在此期间相同键的邮件只发送一次，默认7天，不应短于任务状态的保存时间
+	DedupTTL time.Duration
+	// MaxRetries 发送失败后的最大重试次数，为0时使用 jobs.Options.MaxRetries
+	MaxRetries int
+}
+
+type outboxPayload struct {
+	Key     string   `json:"key"`
+	Message *Message `json:"message"`
+}
+
+// Outbox 持久化的发件箱，邮件先保存到Redis中的任务队列，再由 jobs.Manager 的工作协程通过Mailer发送，
+// 失败时按任务管理器的退避策略重试，超过重试次数或邮件无效时标记为失败。需要运行 jobs.Manager.Run 才会发送
+type Outbox struct {
+	client  redis.UniversalClient
+	manager *jobs.Manager
+	mailer  *Mailer
+	options OutboxOptions
+}
+
+// NewOutbox 创建发件箱并在manager中注册投递任务，一个manager只能注册一个发件箱
+func NewOutbox(client redis.UniversalClient, manager *jobs.Manager, mailer *Mailer, options OutboxOptions) *Outbox {
+	if options.Queue == "" {
+		options.Queue = jobs.DefaultQueue
+	}
+	if options.Prefix == "" {
+		options.Prefix = "neutron:email:outbox:"
+	}
+	if options.DedupTTL <= 0 {
+		options.DedupTTL = 7 * 24 * time.Hour
+	}
+	outbox := &Outbox{client: client, manager: manager, mailer: mailer, options: options}
+	jobs.Register(manager, OutboxJobName, outbox.deliver)
+	return outbox
+}
+
+func (o *Outbox) queuedKey(key string) string {
+	return o.options.Prefix + "queued:" + key
+}
+
+func (o *Outbox) sentKey(key string) string {
+	return o.options.Prefix + "sent:" + key
+}
+
+func jobId(key string) string {
+	return "email:" + key
+}
+
+// Enqueue 把邮件放入发件箱，返回消息键。key用于去重，相同key的邮件只会发送一次，重复放入时直接返回；
+// key为空时生成一个随机的键。邮件无效时立即返回错误
+func (o *Outbox) Enqueue(ctx context.Context, key string, message *Message) (string, error) {
+	if key == "" {
+		key = uuid.NewString()
+	}
+	outgoing, err := o.mailer.prepare(message)
+	if err != nil {
+		return "", err
+	}
+	created, err := o.client.SetNX(ctx, o.queuedKey(key), time.Now().Unix(), o.options.DedupTTL).Result()
+	if err != nil {
+		return "", fmt.Errorf("outbox enqueue %s: %w", key, err)
+	}
+	if !created {
+		return key, nil
+	}
+	opts := []jobs.EnqueueOption{jobs.InQueue(o.options.Queue), jobs.WithId(jobId(key))}
+	if o.options.MaxRetries > 0 {
+		opts = append(opts, jobs.MaxRetries(o.options.MaxRetries))
+	}
+	if _, err := o.manager.Enqueue(ctx, OutboxJobName, outboxPayload{Key: key, Message: outgoing}, opts...); err != nil {
+		// 入队失败时删除去重标记，允许调用方使用相同的键重试
+		if delErr := o.client.Del(context.WithoutCancel(ctx), o.queuedKey(key)).Err(); delErr != nil {
+			inlogger.Logger.Warnf("email outbox: %v", delErr)
+		}
+		return "", fmt.Errorf("outbox enqueue %s: %w", key, err)
+	}
+	return key, nil
+}
+
+// deliver 发送一封邮件。工作协程在发送之后、确认之前退出时任务会被重新执行，发送成功的标记用于避免重复发送
+func (o *Outbox) deliver(ctx context.Context, payload outboxPayload) error {
+	sent, err := o.client.Exists(ctx, o.sentKey(payload.Key)).Result()
+	if err != nil {
+		return fmt.Errorf("check sent %s: %w", payload.Key, err)
+	}
+	if sent > 0 {
+		return nil
+	}
+	if payload.Message == nil {
+		return jobs.Permanent(fmt.Errorf("%w: empty payload", ErrInvalidMessage))
+	}
+	if err := o.mailer.Send(ctx, payload.Message); err != nil {
+		if errors.Is(err, ErrInvalidMessage) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if err := o.client.Set(ctx, o.sentKey(payload.Key), time.Now().Unix(), o.options.DedupTTL).Err(); err != nil {
+		inlogger.Logger.Warnf("email outbox: mark %s as sent: %v", payload.Key, err)
+	}
+	return nil
+}
+
+// Status 查询邮件的投递状态，消息键不存在或状态已过期时返回 models.ErrNotFound
+func (o *Outbox) Status(ctx context.Context, key string) (*Delivery, error) {
+	state, err := o.manager.Status(ctx, jobId(key))
+	if err != nil {
+		return nil, err
+	}
+	delivery := &Delivery{
+		Key:        key,
+		Attempts:   state.Attempt,
+		LastError:  state.LastError,
+		UpdateTime: state.UpdateTime,
+	}
+	switch state.Status {
+	case jobs.StatusRunning:
+		delivery.Status = DeliverySending
+	case jobs.StatusRetrying:
+		delivery.Status = DeliveryRetrying
+		delivery.NextAttempt = state.RunAt
+	case jobs.StatusSucceeded:
+		delivery.Status = DeliverySent
+	case jobs.StatusFailed:
+		delivery.Status = DeliveryFailed
+	default:
+		delivery.Status = DeliveryQueued
+	}
+	return delivery, nil
+}
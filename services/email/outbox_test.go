@@ -0,0 +1,104 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pnnh/neutron/models"
+	"github.com/pnnh/neutron/services/jobs"
+	"github.com/redis/go-redis/v9"
+)
+
+// flakyTransport 前failures次发送失败，收件人为down@example.com时总是失败
+type flakyTransport struct {
+	*MemoryTransport
+	failures atomic.Int32
+}
+
+func (t *flakyTransport) Send(ctx context.Context, message *Message) error {
+	if message.To[0] == "down@example.com" {
+		return errors.New("connection refused")
+	}
+	if t.failures.Add(-1) >= 0 {
+		return errors.New("temporary failure")
+	}
+	return t.MemoryTransport.Send(ctx, message)
+}
+
+func TestOutbox(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	transport := &flakyTransport{MemoryTransport: NewMemoryTransport()}
+	transport.failures.Store(1)
+	mailer := NewMailer(transport, MailerConfig{From: "noreply@example.com", Rate: -1})
+	manager := jobs.NewManager(client, jobs.Options{
+		Backoff:      func(attempt int) time.Duration { return 0 },
+		PollInterval: 10 * time.Millisecond,
+	})
+	outbox := NewOutbox(client, manager, mailer, OutboxOptions{MaxRetries: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- manager.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	message := &Message{To: []string{"alice@example.com"}, Subject: "receipt", Text: "thanks"}
+	for i := 0; i < 2; i++ {
+		if key, err := outbox.Enqueue(ctx, "order-1", message); err != nil || key != "order-1" {
+			t.Fatalf("Enqueue #%d = %s, %v", i, key, err)
+		}
+	}
+	if _, err := outbox.Enqueue(ctx, "", &Message{To: []string{"alice@example.com"}}); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("Enqueue() without body = %v, want ErrInvalidMessage", err)
+	}
+	failedKey, err := outbox.Enqueue(ctx, "", &Message{To: []string{"down@example.com"}, Text: "x"})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	waitForDelivery(t, outbox, "order-1", DeliverySent)
+	delivery := waitForDelivery(t, outbox, failedKey, DeliveryFailed)
+	if delivery.Attempts != 3 || delivery.LastError != "connection refused" {
+		t.Fatalf("failed delivery = %+v", delivery)
+	}
+	if delivery, _ := outbox.Status(ctx, "order-1"); delivery.Attempts != 2 {
+		t.Fatalf("order-1 delivery = %+v", delivery)
+	}
+	if sent := transport.Messages(); len(sent) != 1 || sent[0].From != "noreply@example.com" {
+		t.Fatalf("sent = %+v, want exactly one message", sent)
+	}
+	if _, err := outbox.Status(ctx, "missing"); !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("Status(missing) = %v, want ErrNotFound", err)
+	}
+
+	// 已发送的邮件被重新执行时不会再次发送
+	if err := outbox.deliver(ctx, outboxPayload{Key: "order-1", Message: message}); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if sent := transport.Messages(); len(sent) != 1 {
+		t.Fatalf("redelivery sent the message again")
+	}
+}
+
+func waitForDelivery(t *testing.T, outbox *Outbox, key, status string) *Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		delivery, err := outbox.Status(context.Background(), key)
+		if err == nil && delivery.Status == status {
+			return delivery
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery %s = %+v, %v, want %s", key, delivery, err, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
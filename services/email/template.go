@@ -0,0 +1,163 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/pnnh/neutron/helpers"
+	"github.com/pnnh/neutron/models"
+)
+
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// 模板文件的扩展名，分别对应邮件的主题、纯文本正文和HTML正文
+const (
+	subjectSuffix = ".subject.tmpl"
+	textSuffix    = ".txt.tmpl"
+	htmlSuffix    = ".html.tmpl"
+)
+
+// Templates 邮件模板集合，模板文件按以下规则命名：
+//
+//	welcome.subject.tmpl      主题，使用text/template
+//	welcome.txt.tmpl          纯文本正文，使用text/template
+//	welcome.html.tmpl         HTML正文，使用html/template
+//	welcome.zh.html.tmpl      指定语言的版本，语言代码参考 models.LangZh 等
+//	_layout.html.tmpl         以下划线开头的文件是公共模板，可以在同类型的所有模板中通过 template 引用
+//
+// 纯文本和HTML正文至少需要其中之一。渲染时优先使用指定语言的版本，其次是 models.DefaultLanguage 的版本，最后是不带语言的版本。
+// 模板中可以使用 helpers.FuncMap 中的函数
+type Templates struct {
+	subjects map[string]*texttemplate.Template
+	texts    map[string]*texttemplate.Template
+	htmls    map[string]*htmltemplate.Template
+}
+
+// ParseTemplates 解析fsys中dir目录下的所有 .tmpl 文件，通常配合embed.FS使用
+func ParseTemplates(fsys fs.FS, dir string) (*Templates, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("list email templates: %w", err)
+	}
+	contents := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("read email template %s: %w", file, err)
+		}
+		contents[path.Base(file)] = string(data)
+	}
+
+	t := &Templates{
+		subjects: make(map[string]*texttemplate.Template),
+		texts:    make(map[string]*texttemplate.Template),
+		htmls:    make(map[string]*htmltemplate.Template),
+	}
+	textFuncs := texttemplate.FuncMap(helpers.FuncMap())
+	for filename, content := range contents {
+		if strings.HasPrefix(filename, "_") {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(filename, subjectSuffix):
+			key := strings.TrimSuffix(filename, subjectSuffix)
+			tmpl, err := texttemplate.New(filename).Funcs(textFuncs).Option("missingkey=error").Parse(content)
+			if err != nil {
+				return nil, fmt.Errorf("parse email template %s: %w", filename, err)
+			}
+			t.subjects[key] = tmpl
+		case strings.HasSuffix(filename, textSuffix):
+			key := strings.TrimSuffix(filename, textSuffix)
+			tmpl := texttemplate.New(filename).Funcs(textFuncs).Option("missingkey=error")
+			if err := parsePartials(contents, textSuffix, content, func(text string) error {
+				_, err := tmpl.Parse(text)
+				return err
+			}); err != nil {
+				return nil, fmt.Errorf("parse email template %s: %w", filename, err)
+			}
+			t.texts[key] = tmpl
+		case strings.HasSuffix(filename, htmlSuffix):
+			key := strings.TrimSuffix(filename, htmlSuffix)
+			tmpl := htmltemplate.New(filename).Funcs(helpers.FuncMap()).Option("missingkey=error")
+			if err := parsePartials(contents, htmlSuffix, content, func(text string) error {
+				_, err := tmpl.Parse(text)
+				return err
+			}); err != nil {
+				return nil, fmt.Errorf("parse email template %s: %w", filename, err)
+			}
+			t.htmls[key] = tmpl
+		}
+	}
+	return t, nil
+}
+
+// parsePartials 先解析同类型的公共模板，再解析模板本身，模板本身的内容作为入口
+func parsePartials(contents map[string]string, suffix, content string, parse func(text string) error) error {
+	for filename, partial := range contents {
+		if strings.HasPrefix(filename, "_") && strings.HasSuffix(filename, suffix) {
+			if err := parse(partial); err != nil {
+				return fmt.Errorf("partial %s: %w", filename, err)
+			}
+		}
+	}
+	return parse(content)
+}
+
+// lookupKeys 按优先级返回模板的查找键
+func lookupKeys(name, lang string) []string {
+	keys := make([]string, 0, 3)
+	if models.IsValidLanguage(lang) {
+		keys = append(keys, name+"."+lang)
+	}
+	if lang != models.DefaultLanguage {
+		keys = append(keys, name+"."+models.DefaultLanguage)
+	}
+	return append(keys, name)
+}
+
+func lookup[T any](templates map[string]T, name, lang string) (T, bool) {
+	for _, key := range lookupKeys(name, lang) {
+		if tmpl, ok := templates[key]; ok {
+			return tmpl, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Render 按语言渲染名为name的模板，返回的邮件包含主题和正文，发件人和收件人由调用方设置
+func (t *Templates) Render(name, lang string, data any) (*Message, error) {
+	message := &Message{}
+	var buffer bytes.Buffer
+	if tmpl, ok := lookup(t.subjects, name, lang); ok {
+		if err := tmpl.Execute(&buffer, data); err != nil {
+			return nil, fmt.Errorf("render email subject %s: %w", name, err)
+		}
+		// 主题不能包含换行
+		message.Subject = strings.Join(strings.Fields(buffer.String()), " ")
+	}
+	if tmpl, ok := lookup(t.texts, name, lang); ok {
+		buffer.Reset()
+		if err := tmpl.Execute(&buffer, data); err != nil {
+			return nil, fmt.Errorf("render email text %s: %w", name, err)
+		}
+		message.Text = buffer.String()
+	}
+	if tmpl, ok := lookup(t.htmls, name, lang); ok {
+		buffer.Reset()
+		if err := tmpl.Execute(&buffer, data); err != nil {
+			return nil, fmt.Errorf("render email html %s: %w", name, err)
+		}
+		message.HTML = buffer.String()
+	}
+	if message.Text == "" && message.HTML == "" {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return message, nil
+}
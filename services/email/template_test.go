@@ -0,0 +1,105 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pnnh/neutron/models"
+)
+
+var testTemplates = fstest.MapFS{
+	"mail/_layout.html.tmpl":       {Data: []byte(`{{define "footer"}}<p>— Neutron</p>{{end}}`)},
+	"mail/welcome.subject.tmpl":    {Data: []byte("Welcome, {{.Name}}")},
+	"mail/welcome.zh.subject.tmpl": {Data: []byte("欢迎，{{.Name}}")},
+	"mail/welcome.txt.tmpl":        {Data: []byte("Hi {{.Name}}, joined {{fmtTime .Joined}}")},
+	"mail/welcome.html.tmpl":       {Data: []byte(`<p>Hi {{.Name}}</p><img src="cid:logo.png">{{template "footer"}}`)},
+	"mail/notice.txt.tmpl":         {Data: []byte("notice")},
+}
+
+type welcomeData struct {
+	Name   string
+	Joined time.Time
+}
+
+func TestRender(t *testing.T) {
+	templates, err := ParseTemplates(testTemplates, "mail")
+	if err != nil {
+		t.Fatalf("ParseTemplates: %v", err)
+	}
+	data := welcomeData{Name: "<Alice>", Joined: time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)}
+	message, err := templates.Render("welcome", models.LangZh, data)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if message.Subject != "欢迎，<Alice>" {
+		t.Fatalf("Subject = %q", message.Subject)
+	}
+	if message.Text != "Hi <Alice>, joined 2024年01月02日 03:04" {
+		t.Fatalf("Text = %q", message.Text)
+	}
+	if !strings.Contains(message.HTML, "<p>Hi &lt;Alice&gt;</p>") || !strings.Contains(message.HTML, "— Neutron") {
+		t.Fatalf("HTML = %q", message.HTML)
+	}
+
+	// 没有日文版本时使用不带语言的版本
+	if message, err := templates.Render("welcome", models.LangJa, data); err != nil || message.Subject != "Welcome, <Alice>" {
+		t.Fatalf("Render(ja) = %+v, %v", message, err)
+	}
+	if message, err := templates.Render("notice", models.LangEn, nil); err != nil || message.Text != "notice" || message.HTML != "" {
+		t.Fatalf("Render(notice) = %+v, %v", message, err)
+	}
+	if _, err := templates.Render("missing", models.LangEn, nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("Render(missing) = %v, want ErrTemplateNotFound", err)
+	}
+}
+
+func TestMessageMime(t *testing.T) {
+	message := &Message{
+		From:    "noreply@example.com",
+		To:      []string{"alice@example.com"},
+		Cc:      []string{"bob@example.com"},
+		Bcc:     []string{"audit@example.com"},
+		ReplyTo: "support@example.com",
+		Subject: "Report",
+		Text:    "plain body",
+		HTML:    `<img src="cid:logo.png">`,
+	}
+	message.Attach("report.csv", "", []byte("a,b\n1,2\n"))
+	message.Embed("logo.png", "image/png", []byte{0x89, 'P', 'N', 'G'})
+	if err := message.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if recipients := message.Recipients(); len(recipients) != 3 {
+		t.Fatalf("Recipients() = %v", recipients)
+	}
+
+	var buffer bytes.Buffer
+	if _, err := message.gomailMessage().WriteTo(&buffer); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	raw := buffer.String()
+	for _, want := range []string{
+		"Cc: bob@example.com",
+		"Reply-To: support@example.com",
+		"multipart/alternative",
+		"text/plain",
+		"text/html",
+		`filename="report.csv"`,
+		"Content-ID: <logo.png>",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Fatalf("message does not contain %q:\n%s", want, raw)
+		}
+	}
+	if strings.Contains(raw, "audit@example.com") {
+		t.Fatalf("Bcc leaked into headers")
+	}
+
+	if err := (&Message{From: "a@example.com", Text: "x"}).Validate(); err == nil {
+		t.Fatalf("Validate() without recipients succeeded")
+	}
+}
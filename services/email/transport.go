@@ -0,0 +1,142 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gomail "gopkg.in/gomail.v2"
+)
+
+// Transport 投递邮件的方式，Send调用时邮件已经过校验
+type Transport interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// SMTPConfig SMTP服务器配置
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// SSL 使用隐式TLS连接，为false时在服务器支持的情况下通过STARTTLS加密，端口为465时默认开启
+	SSL bool
+	// LocalName HELO时使用的主机名，为空时使用localhost
+	LocalName string
+}
+
+// SMTPTransport 通过SMTP服务器发送，每封邮件建立一次连接
+type SMTPTransport struct {
+	dialer *gomail.Dialer
+}
+
+func NewSMTPTransport(config SMTPConfig) *SMTPTransport {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	dialer := gomail.NewDialer(config.Host, config.Port, config.Username, config.Password)
+	if config.SSL {
+		dialer.SSL = true
+	}
+	dialer.LocalName = config.LocalName
+	return &SMTPTransport{dialer: dialer}
+}
+
+// Send 发送邮件，ctx只在建立连接前检查，发送过程中不能取消
+func (t *SMTPTransport) Send(ctx context.Context, message *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := t.dialer.DialAndSend(message.gomailMessage()); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	return nil
+}
+
+// FileTransport 把邮件保存为Maildir格式的文件，用于开发环境，可以用邮件客户端打开dir/new下的文件查看
+type FileTransport struct {
+	dir      string
+	hostname string
+	sequence atomic.Uint64
+}
+
+// NewFileTransport 创建Maildir目录结构，dir不存在时自动创建
+func NewFileTransport(dir string) (*FileTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("create maildir %s: %w", dir, err)
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	return &FileTransport{dir: dir, hostname: hostname}, nil
+}
+
+// Send 先写入tmp目录，完成后移动到new目录，读取方不会看到写了一半的文件
+func (t *FileTransport) Send(ctx context.Context, message *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := strconv.FormatInt(now.Unix(), 10) + ".M" + strconv.Itoa(now.Nanosecond()/1000) +
+		"P" + strconv.Itoa(os.Getpid()) + "Q" + strconv.FormatUint(t.sequence.Add(1), 10) + "." + t.hostname
+	tmpPath := filepath.Join(t.dir, "tmp", name)
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create mail file: %w", err)
+	}
+	if _, err := message.gomailMessage().WriteTo(file); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write mail file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write mail file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(t.dir, "new", name)); err != nil {
+		return fmt.Errorf("deliver mail file: %w", err)
+	}
+	return nil
+}
+
+// MemoryTransport 把邮件保存在内存中，用于测试
+type MemoryTransport struct {
+	mutex    sync.Mutex
+	messages []*Message
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, message *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	copied := *message
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.messages = append(t.messages, &copied)
+	return nil
+}
+
+// Messages 返回已发送的邮件，按发送顺序排列
+func (t *MemoryTransport) Messages() []*Message {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]*Message(nil), t.messages...)
+}
+
+func (t *MemoryTransport) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.messages = nil
+}
@@ -0,0 +1,134 @@
+// Package eventbus 在服务之间广播领域事件：
+//
+//	var ArticlePublished = eventbus.NewTopic[ArticleEvent]("article.published")
+//
+//	bus := eventbus.NewRedisBus(client, eventbus.RedisOptions{})
+//	ArticlePublished.Subscribe(ctx, bus, "search-indexer", func(ctx context.Context, event *eventbus.Event[ArticleEvent]) error {
+//		...
+//	})
+//	ArticlePublished.Publish(ctx, bus, ArticleEvent{...})
+//
+// 订阅者指定消费者组时，同组的订阅者竞争消费，每个事件只被其中一个处理；消费者组为空时为广播订阅，
+// 每个订阅者都会收到订阅之后发布的所有事件。处理函数返回错误时事件会被重新投递，即至少一次语义，处理函数应当幂等
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrBusClosed = errors.New("event bus closed")
+
+// Envelope 事件的JSON信封
+type Envelope struct {
+	Id       string            `json:"id"`
+	Topic    string            `json:"topic"`
+	Time     time.Time         `json:"time"`
+	TraceId  string            `json:"trace_id,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Data     json.RawMessage   `json:"data"`
+}
+
+// NewEnvelope 创建事件信封，data按JSON编码，TraceId从ctx中读取
+func NewEnvelope(ctx context.Context, topic string, data any) (*Envelope, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode event data: %w", err)
+	}
+	envelope := &Envelope{
+		Id:    uuid.NewString(),
+		Topic: topic,
+		Time:  time.Now(),
+		Data:  payload,
+	}
+	envelope.TraceId, _ = TraceIdFrom(ctx)
+	return envelope, nil
+}
+
+// Handler 处理一个事件，返回错误时事件会被重新投递
+type Handler func(ctx context.Context, envelope *Envelope) error
+
+// Subscription 一个订阅，Close 停止接收新事件并等待正在处理的事件完成
+type Subscription interface {
+	Close() error
+}
+
+// Bus 事件总线
+type Bus interface {
+	Publish(ctx context.Context, envelope *Envelope) error
+	// Subscribe 订阅topic，group为空时为广播订阅。ctx结束或调用 Subscription.Close 时订阅停止
+	Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error)
+	Close() error
+}
+
+type traceKey struct{}
+
+// WithTraceId 返回携带追踪ID的ctx，在ctx中发布的事件会带上该ID，处理事件时的ctx也携带事件的追踪ID
+func WithTraceId(ctx context.Context, traceId string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceId)
+}
+
+func TraceIdFrom(ctx context.Context) (string, bool) {
+	traceId, ok := ctx.Value(traceKey{}).(string)
+	return traceId, ok && traceId != ""
+}
+
+// handlerContext 处理事件时的ctx，携带事件的追踪ID
+func handlerContext(ctx context.Context, envelope *Envelope) context.Context {
+	if envelope.TraceId == "" {
+		return ctx
+	}
+	return WithTraceId(ctx, envelope.TraceId)
+}
+
+// Topic 数据类型为T的事件主题
+type Topic[T any] struct {
+	Name string
+}
+
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{Name: name}
+}
+
+// Event 解码后的事件
+type Event[T any] struct {
+	Id       string
+	Topic    string
+	Time     time.Time
+	TraceId  string
+	Metadata map[string]string
+	Data     T
+}
+
+// Publish 发布事件，metadata为附加的元数据，可以为nil
+func (t Topic[T]) Publish(ctx context.Context, bus Bus, data T, metadata map[string]string) error {
+	envelope, err := NewEnvelope(ctx, t.Name, data)
+	if err != nil {
+		return err
+	}
+	envelope.Metadata = metadata
+	return bus.Publish(ctx, envelope)
+}
+
+// Subscribe 订阅事件，事件数据按JSON解码为T，无法解码的事件会被重新投递
+func (t Topic[T]) Subscribe(ctx context.Context, bus Bus, group string,
+	handler func(ctx context.Context, event *Event[T]) error) (Subscription, error) {
+	return bus.Subscribe(ctx, t.Name, group, func(ctx context.Context, envelope *Envelope) error {
+		event := &Event[T]{
+			Id:       envelope.Id,
+			Topic:    envelope.Topic,
+			Time:     envelope.Time,
+			TraceId:  envelope.TraceId,
+			Metadata: envelope.Metadata,
+		}
+		if err := json.Unmarshal(envelope.Data, &event.Data); err != nil {
+			return fmt.Errorf("decode event %s: %w", envelope.Id, err)
+		}
+		return handler(ctx, event)
+	})
+}
@@ -0,0 +1,161 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type articleEvent struct {
+	Pk    string `json:"pk"`
+	Title string `json:"title"`
+}
+
+var articlePublished = NewTopic[articleEvent]("article.published")
+
+func TestBus(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	buses := map[string]func() Bus{
+		"memory": func() Bus { return NewMemoryBus(0) },
+		"redis": func() Bus {
+			return NewRedisBus(client, RedisOptions{
+				VisibilityTimeout: 50 * time.Millisecond,
+				BlockTimeout:      10 * time.Millisecond,
+			})
+		},
+	}
+	for name, newBus := range buses {
+		t.Run(name, func(t *testing.T) {
+			bus := newBus()
+			defer bus.Close()
+			ctx := context.Background()
+
+			var mutex sync.Mutex
+			received := make(map[string][]string)
+			traces := make(map[string]string)
+			record := func(subscriber string) func(ctx context.Context, event *Event[articleEvent]) error {
+				return func(ctx context.Context, event *Event[articleEvent]) error {
+					mutex.Lock()
+					defer mutex.Unlock()
+					received[subscriber] = append(received[subscriber], event.Data.Pk)
+					traces[event.Data.Pk], _ = TraceIdFrom(ctx)
+					return nil
+				}
+			}
+			// 两个广播订阅者都收到所有事件，同组的两个订阅者合计收到一次
+			for _, subscriber := range []string{"cache", "audit"} {
+				if _, err := articlePublished.Subscribe(ctx, bus, "", record(subscriber)); err != nil {
+					t.Fatalf("Subscribe: %v", err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := articlePublished.Subscribe(ctx, bus, "indexer", record("indexer")); err != nil {
+					t.Fatalf("Subscribe: %v", err)
+				}
+			}
+			var attempts atomic.Int32
+			_, err := articlePublished.Subscribe(ctx, bus, "flaky", func(ctx context.Context, event *Event[articleEvent]) error {
+				if attempts.Add(1) == 1 {
+					return errors.New("temporary failure")
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+
+			publishCtx := WithTraceId(ctx, "trace-1")
+			if err := articlePublished.Publish(publishCtx, bus, articleEvent{Pk: "a", Title: "first"}, nil); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+			if err := articlePublished.Publish(ctx, bus, articleEvent{Pk: "b"}, map[string]string{"source": "test"}); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				mutex.Lock()
+				done := len(received["cache"]) == 2 && len(received["audit"]) == 2 && len(received["indexer"]) == 2
+				mutex.Unlock()
+				if done && attempts.Load() >= 3 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("received = %v, flaky attempts = %d", received, attempts.Load())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			time.Sleep(100 * time.Millisecond)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(received["indexer"]) != 2 {
+				t.Fatalf("indexer group received %v, want each event once", received["indexer"])
+			}
+			if traces["a"] != "trace-1" || traces["b"] != "" {
+				t.Fatalf("trace ids = %v", traces)
+			}
+		})
+	}
+}
+
+func TestRedisBroadcastCleanup(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	bus := NewRedisBus(client, RedisOptions{
+		VisibilityTimeout: 20 * time.Millisecond,
+		MaxDeliveries:     1,
+		BlockTimeout:      10 * time.Millisecond,
+	})
+	defer bus.Close()
+
+	// 订阅的ctx结束而不是调用Close时，广播订阅的消费者组和死信队列也会被删除
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := articlePublished.Subscribe(ctx, bus, "", func(ctx context.Context, event *Event[articleEvent]) error {
+		return errors.New("always fails")
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := articlePublished.Publish(context.Background(), bus, articleEvent{Pk: "a"}, nil); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	stream := bus.streamKey(articlePublished.Name)
+	waitFor(t, "dead letter", func() bool {
+		keys, _ := client.Keys(context.Background(), stream+":dead:*").Result()
+		return len(keys) == 1
+	})
+
+	cancel()
+	waitFor(t, "cleanup", func() bool {
+		groups, _ := client.XInfoGroups(context.Background(), stream).Result()
+		keys, _ := client.Keys(context.Background(), stream+":dead:*").Result()
+		bus.mutex.Lock()
+		subs := len(bus.subs)
+		bus.mutex.Unlock()
+		return len(groups) == 0 && len(keys) == 0 && subs == 0
+	})
+	if err := sub.Close(); err != nil {
+		t.Fatalf("Close() after ctx ended = %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,165 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/internal/inlogger"
+)
+
+// memoryBufferSize 每个消费者组缓冲的事件数，缓冲满时 Publish 阻塞
+const memoryBufferSize = 1024
+
+// MemoryBus 进程内的事件总线，用于测试和单实例部署，进程退出时未处理的事件会丢失
+type MemoryBus struct {
+	maxDeliveries int
+
+	mutex  sync.Mutex
+	closed bool
+	topics map[string]map[string]*memoryGroup
+	subs   map[*memorySubscription]struct{}
+}
+
+type memoryGroup struct {
+	events  chan *memoryDelivery
+	members int
+}
+
+type memoryDelivery struct {
+	envelope   *Envelope
+	deliveries int
+}
+
+// NewMemoryBus 创建进程内的事件总线，处理失败的事件最多投递maxDeliveries次，为0时使用默认值5
+func NewMemoryBus(maxDeliveries int) *MemoryBus {
+	if maxDeliveries <= 0 {
+		maxDeliveries = 5
+	}
+	return &MemoryBus{
+		maxDeliveries: maxDeliveries,
+		topics:        make(map[string]map[string]*memoryGroup),
+		subs:          make(map[*memorySubscription]struct{}),
+	}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, envelope *Envelope) error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return ErrBusClosed
+	}
+	groups := make([]*memoryGroup, 0, len(b.topics[envelope.Topic]))
+	for _, group := range b.topics[envelope.Topic] {
+		groups = append(groups, group)
+	}
+	b.mutex.Unlock()
+
+	for _, group := range groups {
+		select {
+		case group.events <- &memoryDelivery{envelope: envelope}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil, ErrBusClosed
+	}
+	if group == "" {
+		group = "broadcast:" + uuid.NewString()
+	}
+	groups, ok := b.topics[topic]
+	if !ok {
+		groups = make(map[string]*memoryGroup)
+		b.topics[topic] = groups
+	}
+	memGroup, ok := groups[group]
+	if !ok {
+		memGroup = &memoryGroup{events: make(chan *memoryDelivery, memoryBufferSize)}
+		groups[group] = memGroup
+	}
+	memGroup.members++
+
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &memorySubscription{bus: b, topic: topic, group: group, cancel: cancel, done: make(chan struct{})}
+	b.subs[sub] = struct{}{}
+	go sub.run(subCtx, memGroup, handler)
+	return sub, nil
+}
+
+// Close 关闭总线并停止所有订阅
+func (b *MemoryBus) Close() error {
+	b.mutex.Lock()
+	b.closed = true
+	subs := make([]*memorySubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mutex.Unlock()
+	for _, sub := range subs {
+		_ = sub.Close()
+	}
+	return nil
+}
+
+type memorySubscription struct {
+	bus    *MemoryBus
+	topic  string
+	group  string
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (s *memorySubscription) run(ctx context.Context, group *memoryGroup, handler Handler) {
+	defer close(s.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-group.events:
+			delivery.deliveries++
+			err := handler(handlerContext(context.WithoutCancel(ctx), delivery.envelope), delivery.envelope)
+			if err == nil {
+				continue
+			}
+			if delivery.deliveries >= s.bus.maxDeliveries {
+				inlogger.Logger.Warnf("eventbus: drop event %s of %s after %d deliveries: %v",
+					delivery.envelope.Id, s.topic, delivery.deliveries, err)
+				continue
+			}
+			// 重新放回消费者组，由同组的任意订阅者再次处理
+			go func() {
+				select {
+				case group.events <- delivery:
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
+}
+
+// Close 停止订阅，等待正在处理的事件完成。消费者组的最后一个订阅者退出时，组中未处理的事件被丢弃
+func (s *memorySubscription) Close() error {
+	s.once.Do(func() {
+		s.cancel()
+		<-s.done
+		b := s.bus
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subs, s)
+		if group, ok := b.topics[s.topic][s.group]; ok {
+			group.members--
+			if group.members == 0 {
+				delete(b.topics[s.topic], s.group)
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,192 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/pnnh/neutron/services/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisOptions Redis事件总线的配置，零值字段使用默认值
+type RedisOptions struct {
+	// Prefix 事件Stream的键前缀，默认为 neutron:events:
+	Prefix string
+	// MaxLen 每个主题保留的近似事件数，默认10000
+	MaxLen int64
+	// VisibilityTimeout 事件处理的最长时间，超时未确认的事件会被同组的其他订阅者重新处理，默认30秒
+	VisibilityTimeout time.Duration
+	// MaxDeliveries 最多投递次数，超过后移入该消费者组的死信队列，默认5次
+	MaxDeliveries int64
+	// Concurrency 每个订阅同时处理的事件数，默认1
+	Concurrency int
+	// BlockTimeout 每次阻塞等待新事件的时间，也决定了关闭订阅时最多等待多久，默认2秒
+	BlockTimeout time.Duration
+}
+
+// RedisBus 基于Redis Stream的事件总线，每个主题是一个Stream，每个消费者组是Stream上的一个消费者组。
+// 消费者组第一次创建时从最新的位置开始，只接收之后发布的事件
+type RedisBus struct {
+	client  redis.UniversalClient
+	options RedisOptions
+
+	mutex  sync.Mutex
+	closed bool
+	subs   map[*redisSubscription]struct{}
+}
+
+func NewRedisBus(client redis.UniversalClient, options RedisOptions) *RedisBus {
+	if options.Prefix == "" {
+		options.Prefix = "neutron:events:"
+	}
+	if options.MaxLen <= 0 {
+		options.MaxLen = 10000
+	}
+	return &RedisBus{
+		client:  client,
+		options: options,
+		subs:    make(map[*redisSubscription]struct{}),
+	}
+}
+
+func (b *RedisBus) streamKey(topic string) string {
+	return b.options.Prefix + topic
+}
+
+func (b *RedisBus) Publish(ctx context.Context, envelope *Envelope) error {
+	b.mutex.Lock()
+	closed := b.closed
+	b.mutex.Unlock()
+	if closed {
+		return ErrBusClosed
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	queue := redisdb.NewQueue(b.client, b.streamKey(envelope.Topic), redisdb.QueueOptions{
+		Consumer: "publisher",
+		MaxLen:   b.options.MaxLen,
+	})
+	if _, err := queue.Produce(ctx, data); err != nil {
+		return fmt.Errorf("publish event %s: %w", envelope.Id, err)
+	}
+	return nil
+}
+
+func (b *RedisBus) Subscribe(ctx context.Context, topic, group string, handler Handler) (Subscription, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil, ErrBusClosed
+	}
+	broadcast := group == ""
+	if broadcast {
+		group = "broadcast-" + uuid.NewString()
+	}
+	stream := b.streamKey(topic)
+	deadLetter := stream + ":dead:" + group
+	queue := redisdb.NewQueue(b.client, stream, redisdb.QueueOptions{
+		Group:             group,
+		VisibilityTimeout: b.options.VisibilityTimeout,
+		MaxDeliveries:     b.options.MaxDeliveries,
+		DeadLetter:        deadLetter,
+		MaxLen:            b.options.MaxLen,
+		Concurrency:       b.options.Concurrency,
+		BlockTimeout:      b.options.BlockTimeout,
+		StartId:           "$",
+		KeepAcked:         true,
+	})
+	if err := queue.CreateGroup(ctx); err != nil {
+		return nil, fmt.Errorf("subscribe %s: %w", topic, err)
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &redisSubscription{bus: b, queue: queue, broadcast: broadcast, deadLetter: deadLetter,
+		cancel: cancel, done: make(chan struct{})}
+	b.subs[sub] = struct{}{}
+	go func() {
+		defer close(sub.done)
+		// 无论订阅因为Close、ctx结束还是出错而停止，都清理订阅
+		defer sub.cleanup()
+		sub.err = queue.Run(subCtx, func(ctx context.Context, message *redisdb.Message) error {
+			envelope := &Envelope{}
+			if err := json.Unmarshal(message.Body, envelope); err != nil {
+				// 无法解析的事件重试也不会成功
+				inlogger.Logger.Warnf("eventbus: drop invalid event %s of %s: %v", message.ID, topic, err)
+				return nil
+			}
+			return handler(handlerContext(ctx, envelope), envelope)
+		})
+		if sub.err != nil {
+			inlogger.Logger.Warnf("eventbus: subscription to %s in group %s stopped: %v", topic, group, sub.err)
+		}
+	}()
+	return sub, nil
+}
+
+// Close 关闭总线并停止所有订阅，不会关闭Redis客户端
+func (b *RedisBus) Close() error {
+	b.mutex.Lock()
+	b.closed = true
+	subs := make([]*redisSubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mutex.Unlock()
+	// 先通知所有订阅停止，再逐个等待
+	for _, sub := range subs {
+		sub.cancel()
+	}
+	for _, sub := range subs {
+		_ = sub.Close()
+	}
+	return nil
+}
+
+type redisSubscription struct {
+	bus        *RedisBus
+	queue      *redisdb.Queue
+	broadcast  bool
+	deadLetter string
+	cancel     context.CancelFunc
+	done       chan struct{}
+	// err 订阅停止的原因，在done关闭前写入
+	err error
+}
+
+// cleanup 在订阅停止后从总线中移除，广播订阅的临时消费者组和死信队列会被删除
+func (s *redisSubscription) cleanup() {
+	s.bus.mutex.Lock()
+	delete(s.bus.subs, s)
+	s.bus.mutex.Unlock()
+	if !s.broadcast {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.queue.DestroyGroup(ctx)
+	if err == nil {
+		if delErr := s.bus.client.Del(ctx, s.deadLetter).Err(); delErr != nil {
+			err = fmt.Errorf("delete dead letter stream: %w", delErr)
+		}
+	}
+	if err != nil {
+		inlogger.Logger.Warnf("eventbus: clean up broadcast subscription: %v", err)
+		if s.err == nil {
+			s.err = err
+		}
+	}
+}
+
+// Close 停止订阅，等待正在处理的事件完成，返回订阅停止的原因或清理时的错误。可以重复调用
+func (s *redisSubscription) Close() error {
+	s.cancel()
+	<-s.done
+	return s.err
+}
@@ -0,0 +1,291 @@
+// Package jobs 基于 redisdb.Queue 的后台任务框架：
+//
+//	manager := jobs.NewManager(client, jobs.Options{Queues: map[string]int{"default": 4, "mail": 1}})
+//	jobs.Register(manager, "send_mail", func(ctx context.Context, payload MailPayload) error {
+//		...
+//	})
+//	go manager.Run(ctx)
+//	manager.Enqueue(ctx, "send_mail", MailPayload{...}, jobs.InQueue("mail"), jobs.Delay(time.Minute))
+//
+// 任务参数以JSON编码，失败的任务按指数退避重试，延迟和定时任务保存在有序集合中，到期后移入队列
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/services/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultQueue = "default"
+
+// Job 队列中的任务
+type Job struct {
+	Id      string          `json:"id"`
+	Name    string          `json:"name"`
+	Queue   string          `json:"queue"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempt 已经执行过的次数
+	Attempt    int       `json:"attempt"`
+	MaxRetries int       `json:"max_retries"`
+	CreateTime time.Time `json:"create_time"`
+}
+
+// Options 任务管理器的配置，零值字段使用默认值
+type Options struct {
+	// Prefix Redis键的前缀，默认为 neutron:jobs
+	Prefix string
+	// Queues 队列名称到并发数的映射，默认只有并发数为1的 default 队列
+	Queues map[string]int
+	// MaxRetries 任务失败后的最大重试次数，默认5次，可以在入队时单独指定
+	MaxRetries int
+	// Backoff 第attempt次失败后等待多久重试，默认从1秒开始指数增长，最长1小时
+	Backoff func(attempt int) time.Duration
+	// PollInterval 检查到期的延迟任务的间隔，默认1秒
+	PollInterval time.Duration
+	// StatusTTL 任务状态的保存时间，默认7天
+	StatusTTL time.Duration
+	// VisibilityTimeout 任务执行的最长时间，超时未完成的任务会被重新执行，默认5分钟
+	VisibilityTimeout time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Prefix == "" {
+		o.Prefix = "neutron:jobs"
+	}
+	if len(o.Queues) == 0 {
+		o.Queues = map[string]int{DefaultQueue: 1}
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 5
+	}
+	if o.Backoff == nil {
+		o.Backoff = ExponentialBackoff(time.Second, time.Hour)
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.StatusTTL <= 0 {
+		o.StatusTTL = 7 * 24 * time.Hour
+	}
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = 5 * time.Minute
+	}
+	return o
+}
+
+// ExponentialBackoff 第n次失败后等待 base*2^(n-1)，不超过maxDelay，并加入最多20%的随机抖动
+func ExponentialBackoff(base, maxDelay time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := maxDelay
+		if shift := attempt - 1; shift < 32 {
+			delay = min(base<<max(shift, 0), maxDelay)
+		}
+		jitter := time.Duration(rand.Int64N(int64(delay)/5 + 1))
+		return delay + jitter
+	}
+}
+
+// permanentError 不需要重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 包装处理函数返回的错误，任务不再重试，直接标记为失败，例如参数无效这类重试也不会成功的错误
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+type handlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+// Manager 注册任务处理函数、投递任务并运行工作协程
+type Manager struct {
+	client  redis.UniversalClient
+	options Options
+
+	mutex    sync.RWMutex
+	handlers map[string]handlerFunc
+	queues   map[string]*redisdb.Queue
+}
+
+func NewManager(client redis.UniversalClient, options Options) *Manager {
+	manager := &Manager{
+		client:   client,
+		options:  options.withDefaults(),
+		handlers: make(map[string]handlerFunc),
+		queues:   make(map[string]*redisdb.Queue),
+	}
+	for name, concurrency := range manager.options.Queues {
+		manager.queues[name] = redisdb.NewQueue(client, manager.streamKey(name), redisdb.QueueOptions{
+			Group:             "neutron-jobs",
+			VisibilityTimeout: manager.options.VisibilityTimeout,
+			DeadLetter:        manager.streamKey(name) + ":dead",
+			Concurrency:       concurrency,
+		})
+	}
+	return manager
+}
+
+// Register 注册名为name的任务，payload按JSON解码为P后传给handler。重复注册时后注册的生效
+func Register[P any](m *Manager, name string, handler func(ctx context.Context, payload P) error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.handlers[name] = func(ctx context.Context, data json.RawMessage) error {
+		var payload P
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return fmt.Errorf("decode payload: %w", err)
+		}
+		return handler(ctx, payload)
+	}
+}
+
+func (m *Manager) handler(name string) (handlerFunc, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	handler, ok := m.handlers[name]
+	return handler, ok
+}
+
+// Redis键使用队列名作为hash tag，同一队列的键在集群中位于同一个槽，延迟任务可以在脚本中原子地移入队列
+func (m *Manager) streamKey(queue string) string {
+	return fmt.Sprintf("%s:{%s}", m.options.Prefix, queue)
+}
+
+func (m *Manager) scheduledKey(queue string) string {
+	return m.streamKey(queue) + ":scheduled"
+}
+
+func (m *Manager) statusKey(id string) string {
+	return fmt.Sprintf("%s:status:%s", m.options.Prefix, id)
+}
+
+type enqueueOptions struct {
+	queue      string
+	runAt      time.Time
+	maxRetries int
+	id         string
+}
+
+type EnqueueOption func(options *enqueueOptions)
+
+// InQueue 投递到指定的队列，默认为 default
+func InQueue(queue string) EnqueueOption {
+	return func(options *enqueueOptions) {
+		options.queue = queue
+	}
+}
+
+// Delay 延迟一段时间后执行
+func Delay(delay time.Duration) EnqueueOption {
+	return func(options *enqueueOptions) {
+		options.runAt = time.Now().Add(delay)
+	}
+}
+
+// At 在指定时间执行
+func At(runAt time.Time) EnqueueOption {
+	return func(options *enqueueOptions) {
+		options.runAt = runAt
+	}
+}
+
+// MaxRetries 指定任务失败后的最大重试次数，0表示不重试
+func MaxRetries(retries int) EnqueueOption {
+	return func(options *enqueueOptions) {
+		options.maxRetries = retries
+	}
+}
+
+// WithId 指定任务ID，默认生成UUID
+func WithId(id string) EnqueueOption {
+	return func(options *enqueueOptions) {
+		options.id = id
+	}
+}
+
+// Enqueue 投递名为name的任务，payload按JSON编码，返回任务ID
+func (m *Manager) Enqueue(ctx context.Context, name string, payload any, opts ...EnqueueOption) (string, error) {
+	options := &enqueueOptions{queue: DefaultQueue, maxRetries: -1}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if _, ok := m.queues[options.queue]; !ok {
+		return "", fmt.Errorf("unknown queue: %s", options.queue)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("encode payload: %w", err)
+	}
+	job := &Job{
+		Id:         options.id,
+		Name:       name,
+		Queue:      options.queue,
+		Payload:    data,
+		MaxRetries: options.maxRetries,
+		CreateTime: time.Now(),
+	}
+	if job.Id == "" {
+		job.Id = uuid.NewString()
+	}
+	if job.MaxRetries < 0 {
+		job.MaxRetries = m.options.MaxRetries
+	}
+	if err := m.push(ctx, job, options.runAt, ""); err != nil {
+		return "", err
+	}
+	return job.Id, nil
+}
+
+// push 把任务放入队列，runAt在未来时放入延迟任务集合。lastError为重试前最后一次执行的错误
+func (m *Manager) push(ctx context.Context, job *Job, runAt time.Time, lastError string) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("encode job: %w", err)
+	}
+	state := &JobState{Job: *job, Status: StatusPending, LastError: lastError}
+	if runAt.After(time.Now()) {
+		state.Status = StatusScheduled
+		state.RunAt = runAt
+		if job.Attempt > 0 {
+			state.Status = StatusRetrying
+		}
+		if err := m.saveState(ctx, state); err != nil {
+			return err
+		}
+		member := redis.Z{Score: float64(runAt.UnixMilli()), Member: data}
+		if err := m.client.ZAdd(ctx, m.scheduledKey(job.Queue), member).Err(); err != nil {
+			return fmt.Errorf("schedule job %s: %w", job.Id, err)
+		}
+		return nil
+	}
+	if err := m.saveState(ctx, state); err != nil {
+		return err
+	}
+	if _, err := m.queues[job.Queue].Produce(ctx, data); err != nil {
+		return fmt.Errorf("enqueue job %s: %w", job.Id, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+type greetPayload struct {
+	Name string `json:"name"`
+}
+
+func TestManager(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	manager := NewManager(client, Options{
+		Backoff:      func(attempt int) time.Duration { return 0 },
+		PollInterval: 10 * time.Millisecond,
+	})
+	greeted := make(chan string, 10)
+	Register(manager, "greet", func(ctx context.Context, payload greetPayload) error {
+		job, _ := JobFrom(ctx)
+		if payload.Name == "flaky" && job.Attempt < 2 {
+			return errors.New("try again")
+		}
+		if payload.Name == "invalid" {
+			return Permanent(errors.New("invalid name"))
+		}
+		if payload.Name == "broken" {
+			return errors.New("always fails")
+		}
+		greeted <- payload.Name
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- manager.Run(ctx) }()
+
+	flakyId, err := manager.Enqueue(ctx, "greet", greetPayload{Name: "flaky"})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	brokenId, _ := manager.Enqueue(ctx, "greet", greetPayload{Name: "broken"}, MaxRetries(1))
+	invalidId, _ := manager.Enqueue(ctx, "greet", greetPayload{Name: "invalid"})
+	if _, err := manager.Enqueue(ctx, "greet", greetPayload{Name: "later"}, Delay(50*time.Millisecond)); err != nil {
+		t.Fatalf("Enqueue delayed: %v", err)
+	}
+	if _, err := manager.Enqueue(ctx, "greet", nil, InQueue("missing")); err == nil {
+		t.Fatalf("Enqueue() into unknown queue succeeded")
+	}
+
+	for _, want := range []string{"flaky", "later"} {
+		select {
+		case name := <-greeted:
+			if name != want {
+				t.Fatalf("greeted %s, want %s", name, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("job %s did not run", want)
+		}
+	}
+	if state, err := manager.Status(ctx, flakyId); err != nil || state.Status != StatusSucceeded || state.Attempt != 2 {
+		t.Fatalf("Status(flaky) = %+v, %v", state, err)
+	}
+	waitFor(t, func() bool {
+		state, err := manager.Status(ctx, brokenId)
+		return err == nil && state.Status == StatusFailed
+	})
+	// 永久错误不重试
+	waitFor(t, func() bool {
+		state, err := manager.Status(ctx, invalidId)
+		return err == nil && state.Status == StatusFailed && state.Attempt == 1
+	})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/jobs", manager.StatsHandler())
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	var result struct {
+		Code int           `json:"code"`
+		Data []*QueueStats `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if result.Code != 200 || len(result.Data) != 1 {
+		t.Fatalf("stats = %s", recorder.Body.String())
+	}
+	stats := result.Data[0]
+	if stats.Succeeded != 2 || stats.Failed != 2 || len(stats.Failures) != 2 {
+		t.Fatalf("stats = %s", recorder.Body.String())
+	}
+	// 两个失败任务完成的先后顺序不确定
+	lastErrors := map[string]bool{stats.Failures[0].LastError: true, stats.Failures[1].LastError: true}
+	if !lastErrors["invalid name"] || !lastErrors["always fails"] {
+		t.Fatalf("failures = %s", recorder.Body.String())
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, time.Minute)
+	for attempt, want := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: time.Minute, 100: time.Minute} {
+		if got := backoff(attempt); got < want || got > want+want/5 {
+			t.Errorf("backoff(%d) = %v, want %v plus jitter", attempt, got, want)
+		}
+	}
+}
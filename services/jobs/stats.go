@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pnnh/neutron/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// QueueStats 队列的统计信息
+type QueueStats struct {
+	Name string `json:"name"`
+	// Pending 等待执行和正在执行的任务数
+	Pending int64 `json:"pending"`
+	// Scheduled 延迟执行和等待重试的任务数
+	Scheduled int64 `json:"scheduled"`
+	// Dead 队列多次投递仍未确认的任务数，通常是工作进程在执行中崩溃
+	Dead      int64       `json:"dead"`
+	Succeeded int64       `json:"succeeded"`
+	Failed    int64       `json:"failed"`
+	Failures  []*JobState `json:"failures"`
+}
+
+// Stats 返回所有队列的统计信息，按队列名称排序，每个队列附带最近的failures条失败记录
+func (m *Manager) Stats(ctx context.Context, failures int64) ([]*QueueStats, error) {
+	names := make([]string, 0, len(m.queues))
+	for name := range m.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]*QueueStats, 0, len(names))
+	for _, name := range names {
+		pipe := m.client.Pipeline()
+		pending := pipe.XLen(ctx, m.streamKey(name))
+		scheduled := pipe.ZCard(ctx, m.scheduledKey(name))
+		dead := pipe.XLen(ctx, m.streamKey(name)+":dead")
+		succeeded := pipe.Get(ctx, m.countKey(name, StatusSucceeded))
+		failed := pipe.Get(ctx, m.countKey(name, StatusFailed))
+		var recent *redis.StringSliceCmd
+		if failures > 0 {
+			recent = pipe.LRange(ctx, m.failuresKey(name), 0, failures-1)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("queue %s stats: %w", name, err)
+		}
+		stats := &QueueStats{
+			Name:      name,
+			Pending:   pending.Val(),
+			Scheduled: scheduled.Val(),
+			Dead:      dead.Val(),
+			Failures:  make([]*JobState, 0),
+		}
+		stats.Succeeded, _ = succeeded.Int64()
+		stats.Failed, _ = failed.Int64()
+		if recent != nil {
+			for _, v := range recent.Val() {
+				state := &JobState{}
+				if err := json.Unmarshal([]byte(v), state); err == nil {
+					stats.Failures = append(stats.Failures, state)
+				}
+			}
+		}
+		results = append(results, stats)
+	}
+	return results, nil
+}
+
+// StatsHandler 以 models.NECommonResult 格式返回队列统计信息，供监控面板使用。
+// 查询参数 failures 指定每个队列返回的失败记录数，默认20
+func (m *Manager) StatsHandler() gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		lang := gctx.Query("lang")
+		if !models.IsValidLanguage(lang) {
+			lang = models.DefaultLanguage
+		}
+		failures := int64(20)
+		if value := gctx.Query("failures"); value != "" {
+			if _, err := fmt.Sscan(value, &failures); err != nil || failures < 0 {
+				gctx.JSON(http.StatusOK, models.NECodeInvalidParams.WithLocalMessage(lang,
+					"failures参数无效", "invalid failures parameter"))
+				return
+			}
+		}
+		stats, err := m.Stats(gctx.Request.Context(), failures)
+		if err != nil {
+			gctx.JSON(http.StatusOK, models.NECodeError.WithError(err))
+			return
+		}
+		gctx.JSON(http.StatusOK, models.NECodeOk.WithLocalData(lang, stats))
+	}
+}
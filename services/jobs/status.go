@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pnnh/neutron/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// 任务的状态
+const (
+	StatusPending   = "pending"
+	StatusScheduled = "scheduled"
+	StatusRunning   = "running"
+	StatusRetrying  = "retrying"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// JobState 任务的当前状态，保存 Options.StatusTTL 时间
+type JobState struct {
+	Job
+	Status     string    `json:"status"`
+	LastError  string    `json:"last_error,omitempty"`
+	RunAt      time.Time `json:"run_at,omitempty"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+func (m *Manager) saveState(ctx context.Context, state *JobState) error {
+	state.UpdateTime = time.Now()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode job state: %w", err)
+	}
+	if err := m.client.Set(ctx, m.statusKey(state.Id), data, m.options.StatusTTL).Err(); err != nil {
+		return fmt.Errorf("save job state %s: %w", state.Id, err)
+	}
+	return nil
+}
+
+// Status 查询任务的状态，任务不存在或状态已过期时返回 models.ErrNotFound
+func (m *Manager) Status(ctx context.Context, id string) (*JobState, error) {
+	data, err := m.client.Get(ctx, m.statusKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load job state %s: %w", id, err)
+	}
+	state := &JobState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("decode job state %s: %w", id, err)
+	}
+	return state, nil
+}
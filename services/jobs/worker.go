@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/pnnh/neutron/services/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+// failuresLimit 每个队列保留的最近失败记录数
+const failuresLimit = 100
+
+// moveDueScript 把到期的延迟任务移入队列，移动和删除在同一个脚本中完成，不会丢失或重复
+var moveDueScript = redis.NewScript(`
+local items = redis.call('zrangebyscore', KEYS[1], '-inf', ARGV[1], 'limit', 0, ARGV[2])
+for _, item in ipairs(items) do
+	redis.call('xadd', KEYS[2], '*', 'body', item)
+	redis.call('zrem', KEYS[1], item)
+end
+return #items
+`)
+
+type jobKey struct{}
+
+// JobFrom 在处理函数中获取当前执行的任务
+func JobFrom(ctx context.Context) (*Job, bool) {
+	job, ok := ctx.Value(jobKey{}).(*Job)
+	return job, ok
+}
+
+// Run 运行所有队列的工作协程和延迟任务的调度，直到ctx结束。ctx结束后等待正在执行的任务完成再返回
+func (m *Manager) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(m.queues))
+	for name, queue := range m.queues {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.poll(ctx, name)
+		}()
+		go func() {
+			defer wg.Done()
+			if err := queue.Run(ctx, m.handle); err != nil {
+				errs <- fmt.Errorf("queue %s: %w", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// poll 定期把到期的延迟任务移入队列
+func (m *Manager) poll(ctx context.Context, queue string) {
+	ticker := time.NewTicker(m.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.moveDue(ctx, queue); err != nil && ctx.Err() == nil {
+			inlogger.Logger.Warnf("jobs: move scheduled jobs of %s: %v", queue, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) moveDue(ctx context.Context, queue string) error {
+	keys := []string{m.scheduledKey(queue), m.streamKey(queue)}
+	for {
+		moved, err := moveDueScript.Run(ctx, m.client, keys, time.Now().UnixMilli(), 100).Int()
+		if err != nil {
+			return err
+		}
+		if moved < 100 {
+			return nil
+		}
+	}
+}
+
+// handle 执行一个任务，失败时自行安排重试，因此总是确认队列中的消息
+func (m *Manager) handle(ctx context.Context, message *redisdb.Message) error {
+	job := &Job{}
+	if err := json.Unmarshal(message.Body, job); err != nil {
+		inlogger.Logger.Warnf("jobs: drop invalid job %s: %v", message.ID, err)
+		return nil
+	}
+	job.Attempt++
+	state := &JobState{Job: *job, Status: StatusRunning}
+	if err := m.saveState(ctx, state); err != nil {
+		inlogger.Logger.Warnf("jobs: %v", err)
+	}
+
+	err := m.execute(ctx, job)
+	if err == nil {
+		state.Status = StatusSucceeded
+		m.count(ctx, job.Queue, StatusSucceeded)
+		if err := m.saveState(ctx, state); err != nil {
+			inlogger.Logger.Warnf("jobs: %v", err)
+		}
+		return nil
+	}
+
+	state.LastError = err.Error()
+	if job.Attempt <= job.MaxRetries && !IsPermanent(err) {
+		runAt := time.Now().Add(m.options.Backoff(job.Attempt))
+		if err := m.push(ctx, job, runAt, state.LastError); err != nil {
+			// 重试安排失败时交给队列重新投递
+			return err
+		}
+		return nil
+	}
+	state.Status = StatusFailed
+	m.count(ctx, job.Queue, StatusFailed)
+	if err := m.saveState(ctx, state); err != nil {
+		inlogger.Logger.Warnf("jobs: %v", err)
+	}
+	if err := m.recordFailure(ctx, state); err != nil {
+		inlogger.Logger.Warnf("jobs: %v", err)
+	}
+	return nil
+}
+
+func (m *Manager) execute(ctx context.Context, job *Job) (err error) {
+	handler, ok := m.handler(job.Name)
+	if !ok {
+		return fmt.Errorf("no handler registered for job %s", job.Name)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(context.WithValue(ctx, jobKey{}, job), job.Payload)
+}
+
+func (m *Manager) countKey(queue, status string) string {
+	return fmt.Sprintf("%s:stats:%s", m.streamKey(queue), status)
+}
+
+func (m *Manager) failuresKey(queue string) string {
+	return m.streamKey(queue) + ":failures"
+}
+
+func (m *Manager) count(ctx context.Context, queue, status string) {
+	if err := m.client.Incr(ctx, m.countKey(queue, status)).Err(); err != nil {
+		inlogger.Logger.Warnf("jobs: count %s: %v", status, err)
+	}
+}
+
+// recordFailure 记录最终失败的任务，每个队列只保留最近的 failuresLimit 条
+func (m *Manager) recordFailure(ctx context.Context, state *JobState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode job state: %w", err)
+	}
+	pipe := m.client.Pipeline()
+	pipe.LPush(ctx, m.failuresKey(state.Queue), data)
+	pipe.LTrim(ctx, m.failuresKey(state.Queue), 0, failuresLimit-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("record failure of job %s: %w", state.Id, err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/helpers"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/pnnh/neutron/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// IdempotencyKeyHeader 客户端生成的幂等键，重试同一个请求时使用相同的值
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader 重放保存的响应时设置为true
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+const (
+	idempotencyProcessing = "processing"
+	idempotencyCompleted  = "completed"
+)
+
+// IdempotencyOptions 幂等中间件的配置，零值字段使用默认值
+type IdempotencyOptions struct {
+	// Prefix Redis键的前缀，默认为 neutron:idempotency:
+	Prefix string
+	// TTL 保存响应的时间，之后相同的键被视为新请求，默认24小时
+	TTL time.Duration
+	// LockTTL 处理中标记的过期时间，请求处理超时或进程崩溃后，超过该时间才允许重试，默认1分钟
+	LockTTL time.Duration
+	// UserFunc 返回当前登录的用户，幂等键按用户隔离；为nil或返回空字符串时按客户端IP隔离
+	UserFunc func(gctx *gin.Context) string
+}
+
+// idempotencyRecord 保存在Redis中的请求状态，处理完成后包含第一次请求的响应
+type idempotencyRecord struct {
+	State       string      `json:"state"`
+	Token       string      `json:"token,omitempty"`
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// 只有处理中标记仍然属于当前请求时才写入或删除，避免覆盖过期后被其他请求重新获得的标记
+var (
+	idempotencyCompleteScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	redis.call('set', KEYS[1], ARGV[2], 'px', ARGV[3])
+	return 1
+end
+return 0
+`)
+	idempotencyReleaseScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('del', KEYS[1])
+end
+return 0
+`)
+)
+
+// skippedReplayHeaders 不随响应重放的头
+var skippedReplayHeaders = map[string]bool{
+	"Content-Length": true,
+	"Date":           true,
+	"Set-Cookie":     true,
+}
+
+// Idempotency 幂等中间件，带有 Idempotency-Key 头的请求第一次处理后保存响应的状态码、头和内容，
+// 相同的键再次请求时直接重放保存的响应。相同的键正在处理时返回409和 models.NECodeConflict，
+// 相同的键用于不同的请求内容时返回422。5xx响应不会保存，客户端可以使用相同的键重试。
+// 没有该头的请求和GET等安全方法不受影响，Redis不可用时直接处理请求
+func Idempotency(client redis.UniversalClient, options IdempotencyOptions) gin.HandlerFunc {
+	if options.Prefix == "" {
+		options.Prefix = "neutron:idempotency:"
+	}
+	if options.TTL <= 0 {
+		options.TTL = 24 * time.Hour
+	}
+	if options.LockTTL <= 0 {
+		options.LockTTL = time.Minute
+	}
+	return func(gctx *gin.Context) {
+		idempotencyKey := gctx.GetHeader(IdempotencyKeyHeader)
+		method := gctx.Request.Method
+		if idempotencyKey == "" || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			gctx.Next()
+			return
+		}
+		lang := requestLang(gctx)
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			gctx.AbortWithStatusJSON(http.StatusBadRequest, models.NECodeInvalidParams.WithLocalMessage(lang,
+				"Idempotency-Key过长", "Idempotency-Key is too long"))
+			return
+		}
+		fingerprint, err := requestFingerprint(gctx)
+		if err != nil {
+			gctx.AbortWithStatusJSON(http.StatusBadRequest, models.NECodeInvalidParams.WithLocalError(lang, err,
+				"读取请求内容失败", "Failed to read request body"))
+			return
+		}
+
+		ctx := gctx.Request.Context()
+		key := options.Prefix + idempotencyScope(gctx, options.UserFunc) + ":" + idempotencyKey
+		processing, err := json.Marshal(idempotencyRecord{
+			State:       idempotencyProcessing,
+			Token:       uuid.NewString(),
+			Fingerprint: fingerprint,
+		})
+		if err != nil {
+			inlogger.Logger.Warnf("Idempotency: %v", err)
+			gctx.Next()
+			return
+		}
+		acquired, err := client.SetNX(ctx, key, processing, options.LockTTL).Result()
+		if err != nil {
+			inlogger.Logger.Warnf("Idempotency: %v", err)
+			gctx.Next()
+			return
+		}
+		if !acquired {
+			replayIdempotent(gctx, client, key, fingerprint, lang)
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: gctx.Writer}
+		gctx.Writer = recorder
+		// 客户端断开后仍然需要保存响应或释放标记
+		ctx = context.WithoutCancel(ctx)
+		completed := false
+		defer func() {
+			// 处理失败或发生panic时删除处理中标记，允许客户端重试
+			if completed {
+				return
+			}
+			if err := idempotencyReleaseScript.Run(ctx, client, []string{key}, processing).Err(); err != nil {
+				inlogger.Logger.Warnf("Idempotency: release %s: %v", key, err)
+			}
+		}()
+		gctx.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		record := idempotencyRecord{
+			State:       idempotencyCompleted,
+			Fingerprint: fingerprint,
+			Status:      status,
+			Header:      make(http.Header),
+			Body:        recorder.body.Bytes(),
+		}
+		for name, values := range recorder.Header() {
+			if !skippedReplayHeaders[name] {
+				record.Header[name] = values
+			}
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			inlogger.Logger.Warnf("Idempotency: %v", err)
+			return
+		}
+		if err := idempotencyCompleteScript.Run(ctx, client, []string{key}, processing, data,
+			options.TTL.Milliseconds()).Err(); err != nil {
+			inlogger.Logger.Warnf("Idempotency: save %s: %v", key, err)
+			return
+		}
+		completed = true
+	}
+}
+
+// replayIdempotent 处理重复的请求，重放已保存的响应或拒绝正在处理中的请求
+func replayIdempotent(gctx *gin.Context, client redis.UniversalClient, key, fingerprint, lang string) {
+	data, err := client.Get(gctx.Request.Context(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// 处理中标记刚好过期或被释放，让客户端稍后重试
+		gctx.AbortWithStatusJSON(http.StatusConflict, models.NECodeConflict.WithLocalMessage(lang,
+			"请稍后重试", "Please retry later"))
+		return
+	}
+	record := idempotencyRecord{}
+	if err == nil {
+		err = json.Unmarshal(data, &record)
+	}
+	if err != nil {
+		inlogger.Logger.Warnf("Idempotency: %v", err)
+		gctx.Next()
+		return
+	}
+	if record.Fingerprint != fingerprint {
+		gctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, models.NECodeInvalidParams.WithLocalMessage(lang,
+			"Idempotency-Key已用于其他请求", "Idempotency-Key was used for a different request"))
+		return
+	}
+	if record.State != idempotencyCompleted {
+		gctx.AbortWithStatusJSON(http.StatusConflict, models.NECodeConflict.WithLocalMessage(lang,
+			"相同的请求正在处理中", "A request with the same Idempotency-Key is in progress"))
+		return
+	}
+	header := gctx.Writer.Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	gctx.Writer.WriteHeader(record.Status)
+	_, _ = gctx.Writer.Write(record.Body)
+	gctx.Abort()
+}
+
+// idempotencyScope 幂等键的隔离范围，不同用户使用相同的键互不影响
+func idempotencyScope(gctx *gin.Context, userFunc func(gctx *gin.Context) string) string {
+	if userFunc != nil {
+		if user := userFunc(gctx); user != "" {
+			return "user:" + user
+		}
+	}
+	return "ip:" + helpers.GetIpAddress(gctx)
+}
+
+// requestFingerprint 请求方法、路径和内容的摘要，读取后恢复请求内容供后续处理使用
+func requestFingerprint(gctx *gin.Context) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(gctx.Request.Method + " " + gctx.Request.URL.RequestURI() + "\n"))
+	if gctx.Request.Body != nil {
+		body, err := io.ReadAll(gctx.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		_ = gctx.Request.Body.Close()
+		gctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// bodyRecorder 在写出响应的同时保存响应内容
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
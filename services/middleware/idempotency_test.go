@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/pnnh/neutron/models"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestIdempotency(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var created atomic.Int32
+	blocking := make(chan struct{})
+	router.Use(Idempotency(client, IdempotencyOptions{
+		UserFunc: func(gctx *gin.Context) string { return gctx.GetHeader("X-User") },
+	}))
+	router.POST("/articles", func(gctx *gin.Context) {
+		if gctx.Query("slow") != "" {
+			<-blocking
+		}
+		n := created.Add(1)
+		gctx.Header("Location", "/articles/1")
+		gctx.JSON(http.StatusCreated, models.NECodeOk.WithLocalData(models.LangEn, map[string]any{"n": n}))
+	})
+	router.POST("/fail", func(gctx *gin.Context) {
+		created.Add(1)
+		gctx.JSON(http.StatusInternalServerError, models.NECodeError.WithLocalData(models.LangEn, nil))
+	})
+
+	request := func(path, user, key, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-User", user)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	first := request("/articles", "alice", "k1", `{"title":"a"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request = %d", first.Code)
+	}
+	replayed := request("/articles", "alice", "k1", `{"title":"a"}`)
+	if replayed.Code != http.StatusCreated || replayed.Body.String() != first.Body.String() ||
+		replayed.Header().Get("Location") != "/articles/1" || replayed.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("replayed = %d %s %v", replayed.Code, replayed.Body.String(), replayed.Header())
+	}
+	if created.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", created.Load())
+	}
+
+	// 键按用户隔离，其他用户使用相同的键是新请求
+	if recorder := request("/articles", "bob", "k1", `{"title":"a"}`); recorder.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("request from another user was replayed")
+	}
+	if recorder := request("/articles", "alice", "k1", `{"title":"b"}`); recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key with different body = %d", recorder.Code)
+	}
+	// 没有幂等键的请求不受影响
+	request("/articles", "alice", "", "")
+	request("/articles", "alice", "", "")
+	if created.Load() != 4 {
+		t.Fatalf("handler called %d times, want 4", created.Load())
+	}
+
+	// 5xx响应不保存，可以使用相同的键重试
+	request("/fail", "alice", "k2", "")
+	request("/fail", "alice", "k2", "")
+	if created.Load() != 6 {
+		t.Fatalf("failed requests were replayed, handler called %d times", created.Load())
+	}
+
+	// 处理中的重复请求返回409
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- request("/articles?slow=1", "alice", "k3", "") }()
+	for !server.Exists("neutron:idempotency:user:alice:k3") {
+		time.Sleep(time.Millisecond)
+	}
+	conflict := request("/articles?slow=1", "alice", "k3", "")
+	result := models.NECommonResult{}
+	if err := json.Unmarshal(conflict.Body.Bytes(), &result); err != nil || conflict.Code != http.StatusConflict ||
+		result.Code != models.NECodeConflict {
+		t.Fatalf("in-flight duplicate = %d %s", conflict.Code, conflict.Body.String())
+	}
+	close(blocking)
+	if recorder := <-done; recorder.Code != http.StatusCreated {
+		t.Fatalf("slow request = %d", recorder.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pnnh/neutron/helpers"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/pnnh/neutron/models"
+	"github.com/pnnh/neutron/services/redisdb"
+)
+
+// KeyFunc 返回请求的限流键，返回空字符串时不限流
+type KeyFunc func(gctx *gin.Context) string
+
+// ByIP 按客户端IP限流
+func ByIP(gctx *gin.Context) string {
+	return "ip:" + helpers.GetIpAddress(gctx)
+}
+
+// ByRoute 按路由限流，同一路由的所有请求共享配额
+func ByRoute(gctx *gin.Context) string {
+	return "route:" + gctx.Request.Method + ":" + gctx.FullPath()
+}
+
+// ByUser 按用户限流，userFunc返回当前登录的用户，未登录时返回空字符串，此时不限流
+func ByUser(userFunc func(gctx *gin.Context) string) KeyFunc {
+	return func(gctx *gin.Context) string {
+		user := userFunc(gctx)
+		if user == "" {
+			return ""
+		}
+		return "user:" + user
+	}
+}
+
+// Combine 组合多个键，例如 Combine(ByRoute, ByIP) 限制每个IP对每个路由的请求，任一键为空时不限流
+func Combine(keyFuncs ...KeyFunc) KeyFunc {
+	return func(gctx *gin.Context) string {
+		keys := make([]string, 0, len(keyFuncs))
+		for _, keyFunc := range keyFuncs {
+			key := keyFunc(gctx)
+			if key == "" {
+				return ""
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, "|")
+	}
+}
+
+// RateLimit 限流中间件，超出限制时返回429状态码、Retry-After头和 models.NECodeTooManyRequests。
+// Redis不可用时放行请求，避免限流组件的故障影响业务
+func RateLimit(limiter redisdb.RateLimiter, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		key := keyFunc(gctx)
+		if key == "" {
+			gctx.Next()
+			return
+		}
+		result, err := limiter.Allow(gctx.Request.Context(), key)
+		if err != nil {
+			inlogger.Logger.Warnf("RateLimit: %v", err)
+			gctx.Next()
+			return
+		}
+		gctx.Header("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		gctx.Header("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		if result.Allowed {
+			gctx.Next()
+			return
+		}
+		retryAfter := int64(math.Ceil(result.RetryAfter.Seconds()))
+		gctx.Header("Retry-After", strconv.FormatInt(max(retryAfter, 1), 10))
+		gctx.AbortWithStatusJSON(http.StatusTooManyRequests, models.NECodeTooManyRequests.WithLocalData(requestLang(gctx), nil))
+	}
+}
+
+// requestLang 返回请求参数lang指定的语言，无效时使用默认语言
+func requestLang(gctx *gin.Context) string {
+	lang := gctx.Query("lang")
+	if !models.IsValidLanguage(lang) {
+		lang = models.DefaultLanguage
+	}
+	return lang
+}
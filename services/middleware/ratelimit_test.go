@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/pnnh/neutron/services/redisdb"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRateLimit(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limiter := redisdb.NewSlidingWindowLimiter(client, 2, time.Minute)
+	router.GET("/articles", RateLimit(limiter, Combine(ByRoute, ByIP)), func(gctx *gin.Context) {
+		gctx.String(http.StatusOK, "ok")
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/articles", nil)
+		req.Header.Set("X-Real-IP", ip)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	for i := 0; i < 2; i++ {
+		if recorder := request("10.0.0.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("request #%d = %d", i, recorder.Code)
+		}
+	}
+	recorder := request("10.0.0.1")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("limited request = %d, headers %v", recorder.Code, recorder.Header())
+	}
+	if recorder := request("10.0.0.2"); recorder.Code != http.StatusOK {
+		t.Fatalf("request from another IP = %d", recorder.Code)
+	}
+
+	// Redis不可用时放行
+	server.Close()
+	if recorder := request("10.0.0.1"); recorder.Code != http.StatusOK {
+		t.Fatalf("request with Redis down = %d", recorder.Code)
+	}
+}
@@ -0,0 +1,292 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// CommandPipeline 管道和事务在 CommandEvent.Command 中的名称
+const CommandPipeline = "pipeline"
+
+// CommandEvent 一次Redis调用的信息，管道调用的Command为 CommandPipeline，Commands为其中的命令数
+type CommandEvent struct {
+	// Name 客户端在注册表中的名称
+	Name     string
+	Command  string
+	Args     []any
+	Commands int
+	Start    time.Time
+	Duration time.Duration
+	Slow     bool
+	// Err 调用返回的错误，redis.Nil 不视为错误
+	Err error
+}
+
+// CommandHook 通过注册表创建的客户端的调用拦截器，BeforeCommand按注册顺序调用，AfterCommand按相反顺序调用
+type CommandHook interface {
+	BeforeCommand(ctx context.Context, event *CommandEvent) context.Context
+	AfterCommand(ctx context.Context, event *CommandEvent)
+}
+
+var (
+	commandHooks     []CommandHook
+	commandHookMutex = sync.RWMutex{}
+)
+
+func RegisterCommandHook(hook CommandHook) {
+	commandHookMutex.Lock()
+	defer commandHookMutex.Unlock()
+	commandHooks = append(commandHooks, hook)
+}
+
+// ClearCommandHooks 移除所有已注册的拦截器
+func ClearCommandHooks() {
+	commandHookMutex.Lock()
+	defer commandHookMutex.Unlock()
+	commandHooks = nil
+}
+
+func currentCommandHooks() []CommandHook {
+	commandHookMutex.RLock()
+	defer commandHookMutex.RUnlock()
+	return commandHooks
+}
+
+// registryHook 把go-redis的调用转发给已注册的 CommandHook，拦截器在调用时读取，客户端创建之后注册的拦截器同样生效
+type registryHook struct {
+	name          string
+	slowThreshold time.Duration
+}
+
+func (h *registryHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *registryHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		hooks := currentCommandHooks()
+		if len(hooks) == 0 {
+			return next(ctx, cmd)
+		}
+		event := &CommandEvent{Name: h.name, Command: cmd.FullName(), Args: cmd.Args(), Commands: 1}
+		return h.observe(ctx, hooks, event, func(ctx context.Context) error {
+			return next(ctx, cmd)
+		})
+	}
+}
+
+func (h *registryHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		hooks := currentCommandHooks()
+		if len(hooks) == 0 {
+			return next(ctx, cmds)
+		}
+		event := &CommandEvent{Name: h.name, Command: CommandPipeline, Commands: len(cmds)}
+		return h.observe(ctx, hooks, event, func(ctx context.Context) error {
+			if err := next(ctx, cmds); err != nil {
+				return err
+			}
+			for _, cmd := range cmds {
+				if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+func (h *registryHook) observe(ctx context.Context, hooks []CommandHook, event *CommandEvent, fn func(ctx context.Context) error) error {
+	for _, hook := range hooks {
+		ctx = hook.BeforeCommand(ctx, event)
+	}
+	event.Start = time.Now()
+	err := fn(ctx)
+	event.Duration = time.Since(event.Start)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		event.Err = err
+	}
+	if h.slowThreshold > 0 {
+		event.Slow = event.Duration >= h.slowThreshold
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].AfterCommand(ctx, event)
+	}
+	return err
+}
+
+// LoggingHook 通过inlogger输出Redis调用日志，只记录命令名和参数个数，慢调用以Warn级别输出
+type LoggingHook struct{}
+
+func NewLoggingHook() *LoggingHook {
+	return &LoggingHook{}
+}
+
+func (h *LoggingHook) BeforeCommand(ctx context.Context, event *CommandEvent) context.Context {
+	return ctx
+}
+
+func (h *LoggingHook) AfterCommand(ctx context.Context, event *CommandEvent) {
+	entry := inlogger.Logger.WithFields(logrus.Fields{
+		"redis":       event.Name,
+		"commands":    event.Commands,
+		"args":        len(event.Args),
+		"duration_ms": float64(event.Duration.Microseconds()) / 1000,
+	})
+	if event.Err != nil {
+		entry.WithError(event.Err).Errorf("redis error: %s", event.Command)
+	} else if event.Slow {
+		entry.Warnf("slow redis: %s", event.Command)
+	} else {
+		entry.Debugf("redis: %s", event.Command)
+	}
+}
+
+// LatencyBuckets 延迟直方图的桶上限，最后一个桶之外的调用计入溢出桶
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	time.Second,
+}
+
+// CommandMetrics 一组调用的计数和延迟直方图，Buckets比LatencyBuckets多一个溢出桶
+type CommandMetrics struct {
+	Count         int64         `json:"count"`
+	Errors        int64         `json:"errors"`
+	Slow          int64         `json:"slow"`
+	TotalDuration time.Duration `json:"total_duration"`
+	MaxDuration   time.Duration `json:"max_duration"`
+	Buckets       []int64       `json:"buckets"`
+}
+
+func newCommandMetrics() *CommandMetrics {
+	return &CommandMetrics{Buckets: make([]int64, len(LatencyBuckets)+1)}
+}
+
+func (m *CommandMetrics) observe(event *CommandEvent) {
+	m.Count++
+	if event.Err != nil {
+		m.Errors++
+	}
+	if event.Slow {
+		m.Slow++
+	}
+	m.TotalDuration += event.Duration
+	if event.Duration > m.MaxDuration {
+		m.MaxDuration = event.Duration
+	}
+	index := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return event.Duration <= LatencyBuckets[i]
+	})
+	m.Buckets[index]++
+}
+
+func (m *CommandMetrics) copy() CommandMetrics {
+	result := *m
+	result.Buckets = append([]int64(nil), m.Buckets...)
+	return result
+}
+
+// NamedCommandMetrics 按客户端和命令名聚合的指标
+type NamedCommandMetrics struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	CommandMetrics
+}
+
+type MetricsSnapshot struct {
+	Clients  map[string]CommandMetrics `json:"clients"`
+	Commands []NamedCommandMetrics     `json:"commands"`
+}
+
+type commandKey struct {
+	name    string
+	command string
+}
+
+// MetricsHook 在内存中累计每个客户端和每个命令的调用次数、错误数、慢调用数和延迟直方图
+type MetricsHook struct {
+	mutex    sync.Mutex
+	clients  map[string]*CommandMetrics
+	commands map[commandKey]*CommandMetrics
+}
+
+func NewMetricsHook() *MetricsHook {
+	return &MetricsHook{
+		clients:  make(map[string]*CommandMetrics),
+		commands: make(map[commandKey]*CommandMetrics),
+	}
+}
+
+func (h *MetricsHook) BeforeCommand(ctx context.Context, event *CommandEvent) context.Context {
+	return ctx
+}
+
+func (h *MetricsHook) AfterCommand(ctx context.Context, event *CommandEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	clientMetrics, ok := h.clients[event.Name]
+	if !ok {
+		clientMetrics = newCommandMetrics()
+		h.clients[event.Name] = clientMetrics
+	}
+	clientMetrics.observe(event)
+
+	key := commandKey{name: event.Name, command: event.Command}
+	cmdMetrics, ok := h.commands[key]
+	if !ok {
+		cmdMetrics = newCommandMetrics()
+		h.commands[key] = cmdMetrics
+	}
+	cmdMetrics.observe(event)
+}
+
+// Snapshot 返回当前指标的副本，命令按调用次数从多到少排序
+func (h *MetricsHook) Snapshot() *MetricsSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	snapshot := &MetricsSnapshot{
+		Clients:  make(map[string]CommandMetrics, len(h.clients)),
+		Commands: make([]NamedCommandMetrics, 0, len(h.commands)),
+	}
+	for name, v := range h.clients {
+		snapshot.Clients[name] = v.copy()
+	}
+	for key, v := range h.commands {
+		snapshot.Commands = append(snapshot.Commands, NamedCommandMetrics{
+			Name:           key.name,
+			Command:        key.command,
+			CommandMetrics: v.copy(),
+		})
+	}
+	sort.Slice(snapshot.Commands, func(i, j int) bool {
+		return snapshot.Commands[i].Count > snapshot.Commands[j].Count
+	})
+	return snapshot
+}
+
+func (h *MetricsHook) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.clients = make(map[string]*CommandMetrics)
+	h.commands = make(map[commandKey]*CommandMetrics)
+}
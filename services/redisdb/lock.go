@@ -0,0 +1,277 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	ErrLockNotHeld     = errors.New("lock not held")
+)
+
+// 只有持有令牌的客户端才能续期和释放锁，避免锁过期后被其他客户端获得时误删
+var (
+	refreshLockScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('pexpire', KEYS[1], ARGV[2])
+end
+return 0
+`)
+	releaseLockScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('del', KEYS[1])
+end
+return 0
+`)
+)
+
+// Lock 基于 SET NX PX 的分布式锁，锁的值是随机令牌
+type Lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+	ttl    time.Duration
+	// refreshed 最近一次成功获取或续期的请求发出时间，锁至少在此后的TTL内有效
+	refreshed atomic.Int64
+
+	mutex     sync.Mutex
+	stopRenew context.CancelFunc
+	renewDone chan struct{}
+}
+
+// TryLock 尝试获取锁，锁已被占用时返回 ErrLockNotAcquired
+func TryLock(ctx context.Context, client redis.UniversalClient, key string, ttl time.Duration) (*Lock, error) {
+	token := uuid.NewString()
+	start := time.Now()
+	ok, err := client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("acquire lock %s: %w", key, err)
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+	lock := &Lock{client: client, key: key, token: token, ttl: ttl}
+	lock.refreshed.Store(start.UnixNano())
+	return lock, nil
+}
+
+// AcquireLock 每隔retryInterval尝试获取一次锁，直到成功或ctx结束
+func AcquireLock(ctx context.Context, client redis.UniversalClient, key string, ttl,
+	retryInterval time.Duration) (*Lock, error) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		lock, err := TryLock(ctx, client, key, ttl)
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Refresh 把锁的过期时间重置为TTL，锁已过期或被其他客户端持有时返回 ErrLockNotHeld
+func (l *Lock) Refresh(ctx context.Context) error {
+	start := time.Now()
+	result, err := refreshLockScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("refresh lock %s: %w", l.key, err)
+	}
+	if result == 0 {
+		return ErrLockNotHeld
+	}
+	l.refreshed.Store(start.UnixNano())
+	return nil
+}
+
+// safeUntil 锁肯定仍然有效的截止时间，预留TTL的十分之一应对时钟误差和网络延迟
+func (l *Lock) safeUntil() time.Time {
+	return time.Unix(0, l.refreshed.Load()).Add(l.ttl - l.ttl/10)
+}
+
+// KeepAlive 在后台每隔TTL的三分之一续期一次，直到 Release 或ctx结束。
+// 返回的通道在锁丢失时关闭，包括锁被其他客户端持有，以及Redis不可用导致锁可能已经过期，
+// 持锁执行的任务应当监听它并及时停止
+func (l *Lock) KeepAlive(ctx context.Context) <-chan struct{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	lost := make(chan struct{})
+	if l.stopRenew != nil {
+		l.stopRenew()
+	}
+	renewCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	l.stopRenew, l.renewDone = cancel, done
+	go func() {
+		defer close(done)
+		interval := max(l.ttl/3, time.Millisecond)
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-timer.C:
+			}
+			deadline := l.safeUntil()
+			refreshCtx, cancelRefresh := context.WithDeadline(renewCtx, deadline)
+			err := l.Refresh(refreshCtx)
+			cancelRefresh()
+			if renewCtx.Err() != nil {
+				return
+			}
+			if errors.Is(err, ErrLockNotHeld) {
+				close(lost)
+				return
+			}
+			// 网络错误时继续重试，直到无法确认锁仍然有效
+			wait := interval
+			if err != nil {
+				if !time.Now().Before(deadline) {
+					close(lost)
+					return
+				}
+				wait = min(wait, time.Until(deadline))
+			}
+			timer.Reset(wait)
+		}
+	}()
+	return lost
+}
+
+// Release 停止续期并释放锁，锁已过期或被其他客户端持有时返回 ErrLockNotHeld
+func (l *Lock) Release(ctx context.Context) error {
+	l.mutex.Lock()
+	if l.stopRenew != nil {
+		l.stopRenew()
+		<-l.renewDone
+		l.stopRenew, l.renewDone = nil, nil
+	}
+	l.mutex.Unlock()
+	result, err := releaseLockScript.Run(ctx, l.client, []string{l.key}, l.token).Int()
+	if err != nil {
+		return fmt.Errorf("release lock %s: %w", l.key, err)
+	}
+	if result == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// ElectionOptions 选主的配置，零值字段使用默认值
+type ElectionOptions struct {
+	// TTL 领导者锁的有效期，领导者崩溃后最多经过TTL其他实例才能接替，默认15秒
+	TTL time.Duration
+	// RetryInterval 非领导者尝试获取锁的间隔，默认为TTL的三分之一
+	RetryInterval time.Duration
+	// OnElected 成为领导者时在新的协程中调用，ctx在失去领导权时取消
+	OnElected func(ctx context.Context)
+	// OnRevoked 失去领导权时调用，此时 OnElected 已经返回
+	OnRevoked func()
+}
+
+// Election 基于 Lock 的选主，多个实例使用相同的key时同一时间只有一个成为领导者
+type Election struct {
+	client  redis.UniversalClient
+	key     string
+	options ElectionOptions
+
+	mutex  sync.RWMutex
+	leader bool
+}
+
+func NewElection(client redis.UniversalClient, key string, options ElectionOptions) *Election {
+	if options.TTL <= 0 {
+		options.TTL = 15 * time.Second
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = options.TTL / 3
+	}
+	return &Election{client: client, key: key, options: options}
+}
+
+// IsLeader 当前实例是否是领导者
+func (e *Election) IsLeader() bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.leader
+}
+
+func (e *Election) setLeader(leader bool) {
+	e.mutex.Lock()
+	e.leader = leader
+	e.mutex.Unlock()
+}
+
+// Run 参与选主直到ctx结束，结束时如果是领导者会主动释放锁，让其他实例尽快接替
+func (e *Election) Run(ctx context.Context) error {
+	for {
+		lock, err := AcquireLock(ctx, e.client, e.key, e.options.TTL, e.options.RetryInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// Redis暂时不可用时等待后重试
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(e.options.RetryInterval):
+			}
+			continue
+		}
+		e.lead(ctx, lock)
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// lead 持有锁期间保持领导者身份，直到锁丢失或ctx结束
+func (e *Election) lead(ctx context.Context, lock *Lock) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := lock.KeepAlive(leaderCtx)
+	e.setLeader(true)
+
+	var wg sync.WaitGroup
+	if e.options.OnElected != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.options.OnElected(leaderCtx)
+		}()
+	}
+	select {
+	case <-ctx.Done():
+	case <-lost:
+	}
+	cancel()
+	wg.Wait()
+	e.setLeader(false)
+	// ctx可能已经结束，释放锁使用独立的超时
+	releaseCtx, releaseCancel := context.WithTimeout(context.WithoutCancel(ctx), e.options.TTL)
+	defer releaseCancel()
+	_ = lock.Release(releaseCtx)
+	if e.options.OnRevoked != nil {
+		e.options.OnRevoked()
+	}
+}
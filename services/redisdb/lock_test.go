@@ -0,0 +1,134 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	lock, err := TryLock(ctx, client, "cron", time.Second)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	if _, err := TryLock(ctx, client, "cron", time.Second); !errors.Is(err, ErrLockNotAcquired) {
+		t.Fatalf("TryLock() on held lock = %v, want ErrLockNotAcquired", err)
+	}
+
+	// 锁过期后被其他客户端获得，原持有者不能释放
+	server.FastForward(2 * time.Second)
+	other, err := TryLock(ctx, client, "cron", time.Second)
+	if err != nil {
+		t.Fatalf("TryLock() after expiry: %v", err)
+	}
+	if err := lock.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("Release() of expired lock = %v, want ErrLockNotHeld", err)
+	}
+	if err := other.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if err := other.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	lock, err = AcquireLock(ctx, client, "cron", 30*time.Millisecond, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	lost := lock.KeepAlive(ctx)
+	time.Sleep(50 * time.Millisecond)
+	if !server.Exists("cron") {
+		t.Fatalf("lock expired while kept alive")
+	}
+	server.Del("cron")
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatalf("KeepAlive did not report lost lock")
+	}
+}
+
+func TestLockKeepAliveUnreachable(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	ttl := 300 * time.Millisecond
+	lock, err := TryLock(ctx, client, "cron", ttl)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	start := time.Now()
+	lost := lock.KeepAlive(ctx)
+	// Redis不可用时锁可能已经过期，超过TTL后必须放弃领导权
+	server.Close()
+	select {
+	case <-lost:
+		t.Fatalf("KeepAlive reported lost lock %v after the first failed refresh", time.Since(start))
+	case <-time.After(ttl / 2):
+	}
+	select {
+	case <-lost:
+		if elapsed := time.Since(start); elapsed >= ttl {
+			t.Fatalf("KeepAlive reported lost lock after %v, want before TTL %v", elapsed, ttl)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("KeepAlive did not report lost lock while Redis was unreachable")
+	}
+}
+
+func TestElection(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	elected := make(chan int, 2)
+	revoked := make(chan int, 2)
+	ctxs := make([]context.CancelFunc, 2)
+	elections := make([]*Election, 2)
+	done := make(chan struct{}, 2)
+	for i := range elections {
+		elections[i] = NewElection(client, "leader", ElectionOptions{
+			TTL:       60 * time.Millisecond,
+			OnElected: func(ctx context.Context) { elected <- i },
+			OnRevoked: func() { revoked <- i },
+		})
+		var ctx context.Context
+		ctx, ctxs[i] = context.WithCancel(context.Background())
+		go func() {
+			_ = elections[i].Run(ctx)
+			done <- struct{}{}
+		}()
+	}
+
+	first := <-elected
+	time.Sleep(100 * time.Millisecond)
+	if !elections[first].IsLeader() || elections[1-first].IsLeader() {
+		t.Fatalf("leader = %d, IsLeader() = %v, %v", first, elections[0].IsLeader(), elections[1].IsLeader())
+	}
+	ctxs[first]()
+	if got := <-revoked; got != first {
+		t.Fatalf("revoked %d, want %d", got, first)
+	}
+	select {
+	case second := <-elected:
+		if second == first {
+			t.Fatalf("stopped instance elected again")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no new leader after the first one stopped")
+	}
+	ctxs[1-first]()
+	<-done
+	<-done
+}
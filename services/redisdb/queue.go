@@ -0,0 +1,458 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pnnh/neutron/internal/inlogger"
+	"github.com/redis/go-redis/v9"
+)
+
+// 队列消息在Stream中的字段
+const (
+	queueFieldBody       = "body"
+	queueFieldSourceId   = "source_id"
+	queueFieldDeliveries = "deliveries"
+)
+
+// QueueOptions 可靠队列的配置，零值字段使用默认值
+type QueueOptions struct {
+	// Group 消费者组名称，同一组内的消费者分摊消息，默认为 neutron
+	Group string
+	// Consumer 当前消费者的名称，默认为主机名加随机后缀
+	Consumer string
+	// VisibilityTimeout 消息被取出后未确认的最长时间，超时后会被其他消费者重新领取，默认30秒
+	VisibilityTimeout time.Duration
+	// MaxDeliveries 最多投递次数，超过后移入死信队列，默认5次
+	MaxDeliveries int64
+	// DeadLetter 死信队列的Stream名称，默认为队列名加 :dead
+	DeadLetter string
+	// BlockTimeout 每次阻塞等待新消息的时间，也决定了ctx取消后多久能退出，默认2秒
+	BlockTimeout time.Duration
+	// MaxLen 队列Stream的近似最大长度，0表示不限制
+	MaxLen int64
+	// Concurrency Run 同时处理消息的协程数，默认1
+	Concurrency int
+	// StartId 新建消费者组时的起始位置，默认为0即从头消费，$表示只消费之后追加的消息
+	StartId string
+	// KeepAcked 确认后保留消息，多个消费者组读取同一个Stream时使用，此时应设置MaxLen限制长度
+	KeepAcked bool
+}
+
+func (o QueueOptions) withDefaults(name string) QueueOptions {
+	if o.Group == "" {
+		o.Group = "neutron"
+	}
+	if o.Consumer == "" {
+		hostname, _ := os.Hostname()
+		o.Consumer = fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8])
+	}
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = 30 * time.Second
+	}
+	if o.MaxDeliveries <= 0 {
+		o.MaxDeliveries = 5
+	}
+	if o.DeadLetter == "" {
+		o.DeadLetter = name + ":dead"
+	}
+	if o.BlockTimeout <= 0 {
+		o.BlockTimeout = 2 * time.Second
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.StartId == "" {
+		o.StartId = "0"
+	}
+	return o
+}
+
+// Queue 基于Redis Stream和消费者组的可靠队列。消息被取出后进入消费者组的待确认列表，
+// 处理成功后调用 Message.Ack 删除；处理失败或消费者崩溃时，消息在可见性超时后被重新投递，
+// 投递次数超过 MaxDeliveries 后移入死信队列
+type Queue struct {
+	client  redis.UniversalClient
+	name    string
+	options QueueOptions
+
+	groupMutex   sync.Mutex
+	groupCreated bool
+}
+
+func NewQueue(client redis.UniversalClient, name string, options QueueOptions) *Queue {
+	return &Queue{
+		client:  client,
+		name:    name,
+		options: options.withDefaults(name),
+	}
+}
+
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// DestroyGroup 删除消费者组及其待确认列表，用于不再使用的临时消费者组
+func (q *Queue) DestroyGroup(ctx context.Context) error {
+	q.groupMutex.Lock()
+	defer q.groupMutex.Unlock()
+	if err := q.client.XGroupDestroy(ctx, q.name, q.options.Group).Err(); err != nil {
+		return fmt.Errorf("destroy consumer group: %w", err)
+	}
+	q.groupCreated = false
+	return nil
+}
+
+// Message 从队列中取出的消息
+type Message struct {
+	ID string
+	// Body 消息内容
+	Body []byte
+	// Deliveries 包括本次在内的投递次数
+	Deliveries int64
+
+	queue *Queue
+}
+
+// CreateGroup 创建消费者组，Stream不存在时一并创建。Receive 和 Run 会自动创建，
+// 起始位置为$时可以提前调用，确保之后追加的消息都能被消费
+func (q *Queue) CreateGroup(ctx context.Context) error {
+	return q.ensureGroup(ctx)
+}
+
+func (q *Queue) ensureGroup(ctx context.Context) error {
+	q.groupMutex.Lock()
+	defer q.groupMutex.Unlock()
+	if q.groupCreated {
+		return nil
+	}
+	err := q.client.XGroupCreateMkStream(ctx, q.name, q.options.Group, q.options.StartId).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group: %w", err)
+	}
+	q.groupCreated = true
+	return nil
+}
+
+// resetGroup Stream被删除后消费者组也随之消失，下次读取时重新创建
+func (q *Queue) resetGroup(err error) {
+	if isNoGroup(err) {
+		q.groupMutex.Lock()
+		q.groupCreated = false
+		q.groupMutex.Unlock()
+	}
+}
+
+// Produce 向队列追加一条消息，返回消息ID
+func (q *Queue) Produce(ctx context.Context, body []byte) (string, error) {
+	args := &redis.XAddArgs{
+		Stream: q.name,
+		Values: map[string]any{queueFieldBody: body},
+	}
+	if q.options.MaxLen > 0 {
+		args.MaxLen = q.options.MaxLen
+		args.Approx = true
+	}
+	id, err := q.client.XAdd(ctx, args).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to add message to queue: %w", err)
+	}
+	return id, nil
+}
+
+// Receive 取出一条消息，优先领取其他消费者超时未确认的消息。队列为空时阻塞，直到有新消息或ctx结束
+func (q *Queue) Receive(ctx context.Context) (*Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := q.ensureGroup(ctx); err != nil {
+			return nil, err
+		}
+		message, err := q.reclaim(ctx)
+		if err != nil {
+			q.resetGroup(err)
+			return nil, err
+		}
+		if message != nil {
+			return message, nil
+		}
+		message, err = q.read(ctx)
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			q.resetGroup(err)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, err
+		}
+		return message, nil
+	}
+}
+
+func (q *Queue) read(ctx context.Context) (*Message, error) {
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.options.Group,
+		Consumer: q.options.Consumer,
+		Streams:  []string{q.name, ">"},
+		Count:    1,
+		Block:    q.options.BlockTimeout,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		for _, v := range stream.Messages {
+			return q.newMessage(v, 1), nil
+		}
+	}
+	return nil, redis.Nil
+}
+
+// reclaim 领取一条超过可见性超时仍未确认的消息，投递次数超限的消息移入死信队列后继续查找
+func (q *Queue) reclaim(ctx context.Context) (*Message, error) {
+	for {
+		messages, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   q.name,
+			Group:    q.options.Group,
+			Consumer: q.options.Consumer,
+			MinIdle:  q.options.VisibilityTimeout,
+			Start:    "0-0",
+			Count:    1,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("reclaim messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil, nil
+		}
+		entry := messages[0]
+		if entry.Values == nil {
+			// 消息已被删除，只需从待确认列表中移除
+			if err := q.client.XAck(ctx, q.name, q.options.Group, entry.ID).Err(); err != nil {
+				return nil, fmt.Errorf("ack deleted message: %w", err)
+			}
+			continue
+		}
+		deliveries, err := q.deliveries(ctx, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		message := q.newMessage(entry, deliveries)
+		if deliveries <= q.options.MaxDeliveries {
+			return message, nil
+		}
+		if err := q.deadLetter(ctx, message); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (q *Queue) deliveries(ctx context.Context, id string) (int64, error) {
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: q.name,
+		Group:  q.options.Group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("pending message %s: %w", id, err)
+	}
+	if len(pending) == 0 {
+		return 1, nil
+	}
+	return pending[0].RetryCount, nil
+}
+
+func (q *Queue) newMessage(entry redis.XMessage, deliveries int64) *Message {
+	message := &Message{ID: entry.ID, Deliveries: deliveries, queue: q}
+	if body, ok := entry.Values[queueFieldBody].(string); ok {
+		message.Body = []byte(body)
+	}
+	return message
+}
+
+// deadLetter 把消息写入死信队列并从原队列中删除
+func (q *Queue) deadLetter(ctx context.Context, message *Message) error {
+	err := q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.options.DeadLetter,
+		Values: map[string]any{
+			queueFieldBody:       message.Body,
+			queueFieldSourceId:   message.ID,
+			queueFieldDeliveries: message.Deliveries - 1,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("add message to dead letter queue: %w", err)
+	}
+	inlogger.Logger.Warnf("queue %s: message %s moved to %s after %d deliveries",
+		q.name, message.ID, q.options.DeadLetter, message.Deliveries-1)
+	return message.Ack(ctx)
+}
+
+// Ack 确认消息已处理完成，从队列中删除，设置了 KeepAcked 时只从待确认列表中移除
+func (m *Message) Ack(ctx context.Context) error {
+	q := m.queue
+	pipe := q.client.Pipeline()
+	pipe.XAck(ctx, q.name, q.options.Group, m.ID)
+	if !q.options.KeepAcked {
+		pipe.XDel(ctx, q.name, m.ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("ack message %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// Nack 放弃处理消息，消息在delay后重新投递。delay不会超过可见性超时，为0时立即可以被重新领取
+func (m *Message) Nack(ctx context.Context, delay time.Duration) error {
+	idle := max(m.queue.options.VisibilityTimeout-delay, 0)
+	if err := m.claim(ctx, idle); err != nil {
+		return fmt.Errorf("nack message %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// Extend 重新计算可见性超时，处理耗时较长的消息时应定期调用，避免被其他消费者领取
+func (m *Message) Extend(ctx context.Context) error {
+	if err := m.claim(ctx, 0); err != nil {
+		return fmt.Errorf("extend message %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// claim 把消息在待确认列表中的空闲时间设置为idle，投递次数保持不变
+func (m *Message) claim(ctx context.Context, idle time.Duration) error {
+	q := m.queue
+	return q.client.Do(ctx, "xclaim", q.name, q.options.Group, q.options.Consumer, 0, m.ID,
+		"idle", idle.Milliseconds(), "retrycount", m.Deliveries, "justid").Err()
+}
+
+// DeadLetters 按写入顺序返回死信队列中的消息，Deliveries为移入前的投递次数，ID为原队列中的消息ID
+func (q *Queue) DeadLetters(ctx context.Context, count int64) ([]*Message, error) {
+	entries, err := q.client.XRangeN(ctx, q.options.DeadLetter, "-", "+", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("read dead letter queue: %w", err)
+	}
+	messages := make([]*Message, 0, len(entries))
+	for _, entry := range entries {
+		message := q.newMessage(entry, 0)
+		if id, ok := entry.Values[queueFieldSourceId].(string); ok {
+			message.ID = id
+		}
+		if deliveries, ok := entry.Values[queueFieldDeliveries].(string); ok {
+			message.Deliveries, _ = strconv.ParseInt(deliveries, 10, 64)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// QueueHandler 处理一条消息，返回nil时消息被确认，返回错误时消息稍后重新投递
+type QueueHandler func(ctx context.Context, message *Message) error
+
+// Run 以 Concurrency 个协程持续消费队列，直到ctx结束。ctx结束后不再领取新消息，
+// 等待正在处理的消息完成后返回nil，处理函数收到的ctx不会因此被取消。
+// 消费者组被删除时自动重新创建，网络错误等暂时性的错误会在稍后重试；
+// 重试也无法成功的错误（例如键的类型不对、没有权限）会停止所有协程并由 Run 返回
+func (q *Queue) Run(ctx context.Context, handler QueueHandler) error {
+	if err := q.ensureGroup(ctx); err != nil {
+		return err
+	}
+	handlerCtx := context.WithoutCancel(ctx)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		runErr  error
+	)
+	for i := 0; i < q.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				message, err := q.Receive(runCtx)
+				if runCtx.Err() != nil {
+					if message != nil {
+						_ = message.Nack(handlerCtx, 0)
+					}
+					return
+				}
+				if err != nil {
+					if isNoGroup(err) {
+						// Receive 已经重置了消费者组状态，下次读取时重新创建
+						inlogger.Logger.Warnf("queue %s: consumer group %s was removed, recreating", q.name, q.options.Group)
+						continue
+					}
+					if !isTemporary(err) {
+						errOnce.Do(func() { runErr = fmt.Errorf("queue %s: receive: %w", q.name, err) })
+						cancel()
+						return
+					}
+					inlogger.Logger.Warnf("queue %s: receive: %v", q.name, err)
+					select {
+					case <-runCtx.Done():
+						return
+					case <-time.After(time.Second):
+					}
+					continue
+				}
+				q.handle(handlerCtx, handler, message)
+			}
+		}()
+	}
+	wg.Wait()
+	return runErr
+}
+
+func isNoGroup(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "NOGROUP")
+}
+
+// isTemporary 网络错误和Redis暂时不可用（加载数据、故障转移等）时可以重试，其他服务端错误重试也不会成功
+func isTemporary(err error) bool {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return true
+	}
+	code, _, _ := strings.Cut(redisErr.Error(), " ")
+	switch code {
+	case "LOADING", "BUSY", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN", "READONLY", "MOVED", "ASK":
+		return true
+	}
+	return false
+}
+
+func (q *Queue) handle(ctx context.Context, handler QueueHandler, message *Message) {
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return handler(ctx, message)
+	}()
+	if err == nil {
+		if err := message.Ack(ctx); err != nil {
+			inlogger.Logger.Warnf("queue %s: %v", q.name, err)
+		}
+		return
+	}
+	inlogger.Logger.Warnf("queue %s: handle message %s (delivery %d): %v", q.name, message.ID, message.Deliveries, err)
+	// 按投递次数线性退避，避免失败的消息被立即反复投递
+	if err := message.Nack(ctx, time.Duration(message.Deliveries)*time.Second); err != nil {
+		inlogger.Logger.Warnf("queue %s: %v", q.name, err)
+	}
+}
@@ -0,0 +1,154 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestClient(t *testing.T) redis.UniversalClient {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestQueueRedelivery(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	queue := NewQueue(client, "jobs", QueueOptions{
+		VisibilityTimeout: 50 * time.Millisecond,
+		MaxDeliveries:     2,
+		BlockTimeout:      10 * time.Millisecond,
+	})
+	if _, err := queue.Produce(ctx, []byte("hello")); err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+
+	message, err := queue.Receive(ctx)
+	if err != nil || string(message.Body) != "hello" || message.Deliveries != 1 {
+		t.Fatalf("Receive() = %+v, %v", message, err)
+	}
+	if err := message.Nack(ctx, 0); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	message, err = queue.Receive(ctx)
+	if err != nil || message.Deliveries != 2 {
+		t.Fatalf("Receive() after nack = %+v, %v", message, err)
+	}
+
+	// 未确认的消息在可见性超时后被其他消费者领取，投递次数超限后进入死信队列
+	other := NewQueue(client, "jobs", QueueOptions{
+		VisibilityTimeout: 50 * time.Millisecond,
+		MaxDeliveries:     2,
+		BlockTimeout:      10 * time.Millisecond,
+	})
+	time.Sleep(60 * time.Millisecond)
+	receiveCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if message, err := other.Receive(receiveCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Receive() = %+v, %v, want dead letter", message, err)
+	}
+	dead, err := queue.DeadLetters(ctx, 10)
+	if err != nil || len(dead) != 1 || string(dead[0].Body) != "hello" || dead[0].Deliveries != 2 {
+		t.Fatalf("DeadLetters() = %+v, %v", dead, err)
+	}
+	if length := client.XLen(ctx, "jobs").Val(); length != 0 {
+		t.Fatalf("queue length = %d, want 0", length)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	client := newTestClient(t)
+	queue := NewQueue(client, "tasks", QueueOptions{BlockTimeout: 10 * time.Millisecond, Concurrency: 2})
+	for i := 0; i < 5; i++ {
+		if _, err := queue.Produce(context.Background(), []byte("task")); err != nil {
+			t.Fatalf("Produce: %v", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled atomic.Int32
+	done := make(chan error)
+	go func() {
+		done <- queue.Run(ctx, func(ctx context.Context, message *Message) error {
+			if handled.Add(1) == 5 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop after cancel")
+	}
+	if handled.Load() != 5 || client.XLen(context.Background(), "tasks").Val() != 0 {
+		t.Fatalf("handled %d messages, %d left", handled.Load(), client.XLen(context.Background(), "tasks").Val())
+	}
+}
+
+func TestQueueRunRecovery(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	queue := NewQueue(client, "tasks", QueueOptions{BlockTimeout: 10 * time.Millisecond})
+	handled := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- queue.Run(ctx, func(ctx context.Context, message *Message) error {
+			handled <- string(message.Body)
+			return nil
+		})
+	}()
+	receive := func(want string) {
+		t.Helper()
+		select {
+		case body := <-handled:
+			if body != want {
+				t.Fatalf("handled %q, want %q", body, want)
+			}
+		case err := <-done:
+			t.Fatalf("Run stopped: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %q was not handled", want)
+		}
+	}
+	if _, err := queue.Produce(ctx, []byte("first")); err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+	receive("first")
+
+	// 消费者组被其他客户端删除后自动重新创建
+	if err := client.XGroupDestroy(ctx, "tasks", "neutron").Err(); err != nil {
+		t.Fatalf("XGroupDestroy: %v", err)
+	}
+	if _, err := queue.Produce(ctx, []byte("second")); err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+	receive("second")
+
+	// 键被替换成其他类型后无法恢复，Run 返回错误
+	if err := client.Del(ctx, "tasks").Err(); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	if err := client.Set(ctx, "tasks", "x", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+			t.Fatalf("Run() = %v, want WRONGTYPE error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop on a permanent error")
+	}
+}
@@ -0,0 +1,133 @@
+package redisdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitPrefix = "neutron:ratelimit:"
+
+// RateLimitResult 一次限流判断的结果
+type RateLimitResult struct {
+	Allowed bool
+	// Limit 窗口内允许的请求数或令牌桶容量
+	Limit int64
+	// Remaining 本次请求之后剩余的配额
+	Remaining int64
+	// RetryAfter 被拒绝时需要等待多久才能重试
+	RetryAfter time.Duration
+}
+
+// RateLimiter 按任意字符串作为键限流，多个进程共享同一个Redis时限制对所有进程生效
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (*RateLimitResult, error)
+}
+
+// 时间统一使用微秒，由客户端传入，脚本中不调用TIME以兼容只读副本和脚本复制
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call('zremrangebyscore', KEYS[1], '-inf', now - window)
+local count = redis.call('zcard', KEYS[1])
+if count + n <= limit then
+	for i = 1, n do
+		redis.call('zadd', KEYS[1], now, ARGV[5] .. ':' .. i)
+	end
+	redis.call('pexpire', KEYS[1], math.ceil(window / 1000))
+	return {1, limit - count - n, 0}
+end
+local retry = window
+local oldest = redis.call('zrange', KEYS[1], 0, 0, 'withscores')
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+end
+return {0, limit - count, retry}
+`)
+
+// SlidingWindowLimiter 滑动窗口日志算法，任意window时长内最多允许limit次请求，没有固定窗口边界处的突发
+type SlidingWindowLimiter struct {
+	client redis.UniversalClient
+	limit  int64
+	window time.Duration
+}
+
+func NewSlidingWindowLimiter(client redis.UniversalClient, limit int64, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{client: client, limit: limit, window: window}
+}
+
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN 判断是否允许n次请求，允许时一次性计入
+func (l *SlidingWindowLimiter) AllowN(ctx context.Context, key string, n int64) (*RateLimitResult, error) {
+	values, err := slidingWindowScript.Run(ctx, l.client, []string{rateLimitPrefix + key},
+		time.Now().UnixMicro(), l.window.Microseconds(), l.limit, n, uuid.NewString()).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("rate limit %s: %w", key, err)
+	}
+	return newRateLimitResult(values, l.limit), nil
+}
+
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local data = redis.call('hmget', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or burst
+local ts = tonumber(data[2]) or now
+tokens = math.min(burst, tokens + math.max(now - ts, 0) / 1000000 * rate)
+local allowed = 0
+local retry = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) / rate * 1000000)
+end
+redis.call('hset', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('pexpire', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// TokenBucketLimiter 令牌桶算法，每秒补充rate个令牌，最多积累burst个，允许短时间的突发
+type TokenBucketLimiter struct {
+	client redis.UniversalClient
+	rate   float64
+	burst  int64
+}
+
+func NewTokenBucketLimiter(client redis.UniversalClient, rate float64, burst int64) *TokenBucketLimiter {
+	return &TokenBucketLimiter{client: client, rate: rate, burst: burst}
+}
+
+func (l *TokenBucketLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN 判断是否有n个令牌，有时一次性取走
+func (l *TokenBucketLimiter) AllowN(ctx context.Context, key string, n int64) (*RateLimitResult, error) {
+	values, err := tokenBucketScript.Run(ctx, l.client, []string{rateLimitPrefix + key},
+		time.Now().UnixMicro(), l.rate, l.burst, n).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("rate limit %s: %w", key, err)
+	}
+	return newRateLimitResult(values, l.burst), nil
+}
+
+func newRateLimitResult(values []int64, limit int64) *RateLimitResult {
+	result := &RateLimitResult{Limit: limit}
+	if len(values) == 3 {
+		result.Allowed = values[0] == 1
+		result.Remaining = max(values[1], 0)
+		result.RetryAfter = time.Duration(values[2]) * time.Microsecond
+	}
+	return result
+}
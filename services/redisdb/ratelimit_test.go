@@ -0,0 +1,39 @@
+package redisdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRateLimiters(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	limiters := map[string]RateLimiter{
+		"sliding": NewSlidingWindowLimiter(client, 3, time.Minute),
+		"bucket":  NewTokenBucketLimiter(client, 0.05, 3),
+	}
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			for i := int64(0); i < 3; i++ {
+				result, err := limiter.Allow(ctx, name+":alice")
+				if err != nil || !result.Allowed || result.Remaining != 2-i {
+					t.Fatalf("Allow() #%d = %+v, %v", i, result, err)
+				}
+			}
+			result, err := limiter.Allow(ctx, name+":alice")
+			if err != nil || result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > time.Minute {
+				t.Fatalf("Allow() over limit = %+v, %v", result, err)
+			}
+			if result, _ := limiter.Allow(ctx, name+":bob"); !result.Allowed {
+				t.Fatalf("Allow() for another key = %+v", result)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ type RedisAddress struct {
 	Db       int    `json:"db"`
 }
 
+// ParseConfig 解析旧的 <host:port password [db]> 格式，新的配置建议使用URL格式，参考 ParseURL
 func ParseConfig(redisUrl string) (*RedisAddress, error) {
 
 	urlArr := strings.Split(redisUrl, " ")
@@ -41,41 +42,25 @@ func ParseConfig(redisUrl string) (*RedisAddress, error) {
 	return redisAddress, nil
 }
 
-var redisClientMap = make(map[string]*redis.Client)
 var locker = &sync.Mutex{}
 
-func ConnectRedis(ctx context.Context, redisUrl string) (*redis.Client, error) {
+// ConnectRedis 按redisUrl连接Redis，相同的redisUrl复用同一个客户端。redisUrl的格式参考 ParseURL。
+// 客户端保存在注册表中，可以通过 CloseAll 关闭，新的代码建议使用 InitFor 和 ClientFor 按名称管理客户端
+func ConnectRedis(ctx context.Context, redisUrl string) (redis.UniversalClient, error) {
 	locker.Lock()
 	defer locker.Unlock()
-	if redisClient, ok := redisClientMap[redisUrl]; ok {
+	name := urlClientName(redisUrl)
+	if redisClient, err := ClientFor(name); err == nil {
 		return redisClient, nil
 	}
-	redisAddress, err := ParseConfig(redisUrl)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %v", err)
+	if err := InitFor(ctx, name, redisUrl); err != nil {
+		return nil, err
 	}
-
-	// 初始化 Redis 客户端
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisAddress.Host,     // Redis 地址
-		Password: redisAddress.Password, // Redis 密码（默认空）
-		DB:       redisAddress.Db,       // Redis 数据库
-	})
-
-	// 检查 Redis 连接
-	_, err = client.Ping(ctx).Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
-	}
-
-	// 将客户端存入全局 map
-	redisClientMap[redisUrl] = client
-	return client, nil
-
+	return ClientFor(name)
 }
 
-// Produce 生产者：向 Redis 队列推送消息
-func Produce(ctx context.Context, client *redis.Client, queueName string, contentData []byte) error {
+// Produce 生产者：向 Redis 队列推送消息。消息取出后即从队列中删除，需要确认和重试时使用 Queue
+func Produce(ctx context.Context, client redis.UniversalClient, queueName string, contentData []byte) error {
 
 	// 使用 LPUSH 将消息推送到队列
 	err := client.LPush(ctx, queueName, contentData).Err()
@@ -86,7 +71,7 @@ func Produce(ctx context.Context, client *redis.Client, queueName string, conten
 }
 
 // Consume 消费者：从 Redis 队列获取并处理消息
-func Consume(ctx context.Context, client *redis.Client, queueName string) ([]byte, error) {
+func Consume(ctx context.Context, client redis.UniversalClient, queueName string) ([]byte, error) {
 
 	// 使用 BRPOP 阻塞获取消息，超时 0 表示无限等待
 	result, err := client.BRPop(ctx, 0*time.Second, queueName).Result()
@@ -0,0 +1,261 @@
+package redisdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pnnh/neutron/services/convert"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultSlowCommandThreshold = 100 * time.Millisecond
+
+var (
+	clientMap   = make(map[string]redis.UniversalClient)
+	clientMutex = sync.RWMutex{}
+	DefaultName = "default"
+)
+
+var ErrRedisNotInitialized = errors.New("redis not initialized")
+
+// RedisConfig 一个命名客户端的配置，连接池字段为0时使用URL中的参数或go-redis的默认值
+type RedisConfig struct {
+	// URL 连接地址，格式参考 ParseURL
+	URL          string
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	PoolTimeout  time.Duration
+	// SlowThreshold 超过该时长的调用标记为慢调用，为0时使用默认值，小于0时不检测
+	SlowThreshold time.Duration
+}
+
+// IConfigGetter 读取配置项的最小接口，config/v2.IConfigStore 满足该接口
+type IConfigGetter = convert.IConfigGetter
+
+// LoadRedisConfig 从配置中读取Redis配置，prefix为配置项前缀，例如 REDIS 对应以下配置项：
+// REDIS_URL 连接地址（必填），REDIS_POOL_SIZE、REDIS_MIN_IDLE_CONNS 连接数，
+// REDIS_DIAL_TIMEOUT、REDIS_READ_TIMEOUT、REDIS_WRITE_TIMEOUT、REDIS_POOL_TIMEOUT、REDIS_SLOW_THRESHOLD 时长（秒或 500ms 这样的格式）
+func LoadRedisConfig(store IConfigGetter, prefix string) (RedisConfig, error) {
+	config := RedisConfig{}
+	redisUrl, err := convert.ConfigString(store, prefix+"_URL")
+	if err != nil {
+		return config, err
+	}
+	if redisUrl == "" {
+		return config, fmt.Errorf("配置项[%s_URL]不存在", prefix)
+	}
+	config.URL = redisUrl
+
+	if config.PoolSize, err = convert.ConfigInt(store, prefix+"_POOL_SIZE"); err != nil {
+		return config, err
+	}
+	if config.MinIdleConns, err = convert.ConfigInt(store, prefix+"_MIN_IDLE_CONNS"); err != nil {
+		return config, err
+	}
+	if config.DialTimeout, err = convert.ConfigDuration(store, prefix+"_DIAL_TIMEOUT"); err != nil {
+		return config, err
+	}
+	if config.ReadTimeout, err = convert.ConfigDuration(store, prefix+"_READ_TIMEOUT"); err != nil {
+		return config, err
+	}
+	if config.WriteTimeout, err = convert.ConfigDuration(store, prefix+"_WRITE_TIMEOUT"); err != nil {
+		return config, err
+	}
+	if config.PoolTimeout, err = convert.ConfigDuration(store, prefix+"_POOL_TIMEOUT"); err != nil {
+		return config, err
+	}
+	if config.SlowThreshold, err = convert.ConfigDuration(store, prefix+"_SLOW_THRESHOLD"); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// applyConfig 用配置中非零的连接池字段覆盖URL中的参数
+func (o *RedisOptions) applyConfig(config RedisConfig) {
+	override := func(poolSize, minIdleConns *int, dial, read, write, pool *time.Duration) {
+		if config.PoolSize > 0 {
+			*poolSize = config.PoolSize
+		}
+		if config.MinIdleConns > 0 {
+			*minIdleConns = config.MinIdleConns
+		}
+		if config.DialTimeout > 0 {
+			*dial = config.DialTimeout
+		}
+		if config.ReadTimeout > 0 {
+			*read = config.ReadTimeout
+		}
+		if config.WriteTimeout > 0 {
+			*write = config.WriteTimeout
+		}
+		if config.PoolTimeout > 0 {
+			*pool = config.PoolTimeout
+		}
+	}
+	switch {
+	case o.Failover != nil:
+		v := o.Failover
+		override(&v.PoolSize, &v.MinIdleConns, &v.DialTimeout, &v.ReadTimeout, &v.WriteTimeout, &v.PoolTimeout)
+	case o.Cluster != nil:
+		v := o.Cluster
+		override(&v.PoolSize, &v.MinIdleConns, &v.DialTimeout, &v.ReadTimeout, &v.WriteTimeout, &v.PoolTimeout)
+	default:
+		v := o.Client
+		override(&v.PoolSize, &v.MinIdleConns, &v.DialTimeout, &v.ReadTimeout, &v.WriteTimeout, &v.PoolTimeout)
+	}
+}
+
+func InitFor(ctx context.Context, name string, redisUrl string) error {
+	return InitWithConfig(ctx, name, RedisConfig{URL: redisUrl})
+}
+
+func Init(ctx context.Context, redisUrl string) error {
+	return InitFor(ctx, DefaultName, redisUrl)
+}
+
+// InitWithConfig 按配置创建并注册一个命名客户端，连接失败时不注册，同名客户端已存在时会关闭旧的客户端
+func InitWithConfig(ctx context.Context, name string, config RedisConfig) error {
+	options, err := ParseURL(config.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	options.applyConfig(config)
+	client := options.NewClient()
+	slowThreshold := config.SlowThreshold
+	if slowThreshold == 0 {
+		slowThreshold = defaultSlowCommandThreshold
+	}
+	client.AddHook(&registryHook{name: name, slowThreshold: slowThreshold})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return register(name, client)
+}
+
+// Register 把已创建的客户端注册为命名客户端，例如测试中连接miniredis的客户端，注册后由注册表负责关闭
+func Register(name string, client redis.UniversalClient) error {
+	client.AddHook(&registryHook{name: name, slowThreshold: defaultSlowCommandThreshold})
+	return register(name, client)
+}
+
+func register(name string, client redis.UniversalClient) error {
+	clientMutex.Lock()
+	previous := clientMap[name]
+	clientMap[name] = client
+	clientMutex.Unlock()
+	if previous != nil && previous != client {
+		if err := previous.Close(); err != nil {
+			return fmt.Errorf("close previous client: %w", err)
+		}
+	}
+	return nil
+}
+
+func ClientFor(name string) (redis.UniversalClient, error) {
+	clientMutex.RLock()
+	client, exists := clientMap[name]
+	clientMutex.RUnlock()
+	if !exists {
+		return nil, ErrRedisNotInitialized
+	}
+	return client, nil
+}
+
+func Client() (redis.UniversalClient, error) {
+	return ClientFor(DefaultName)
+}
+
+func PingFor(ctx context.Context, name string) error {
+	client, err := ClientFor(name)
+	if err != nil {
+		return err
+	}
+	return client.Ping(ctx).Err()
+}
+
+// HealthCheck 检查所有已注册的客户端，返回每个客户端的检查结果，健康的客户端对应nil
+func HealthCheck(ctx context.Context) map[string]error {
+	clientMutex.RLock()
+	clients := make(map[string]redis.UniversalClient, len(clientMap))
+	for name, client := range clientMap {
+		clients[name] = client
+	}
+	clientMutex.RUnlock()
+
+	result := make(map[string]error, len(clients))
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for name, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := client.Ping(ctx).Err()
+			mutex.Lock()
+			result[name] = err
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+func StatsFor(name string) (*redis.PoolStats, error) {
+	client, err := ClientFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return client.PoolStats(), nil
+}
+
+// AllStats 返回所有已注册客户端的连接池使用情况
+func AllStats() map[string]*redis.PoolStats {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+	result := make(map[string]*redis.PoolStats, len(clientMap))
+	for name, client := range clientMap {
+		result[name] = client.PoolStats()
+	}
+	return result
+}
+
+func CloseFor(name string) error {
+	clientMutex.Lock()
+	client, exists := clientMap[name]
+	delete(clientMap, name)
+	clientMutex.Unlock()
+	if !exists {
+		return ErrRedisNotInitialized
+	}
+	return client.Close()
+}
+
+// CloseAll 关闭所有已注册的客户端，用于程序退出时释放连接，也可以在测试之间重置注册表
+func CloseAll() error {
+	clientMutex.Lock()
+	clients := clientMap
+	clientMap = make(map[string]redis.UniversalClient)
+	clientMutex.Unlock()
+	var closeErr error
+	for name, client := range clients {
+		if err := client.Close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("close %s: %w", name, err)
+		}
+	}
+	return closeErr
+}
+
+// urlClientName ConnectRedis 创建的客户端在注册表中的名称，使用URL的摘要避免密码出现在日志和指标中
+func urlClientName(redisUrl string) string {
+	sum := sha256.Sum256([]byte(redisUrl))
+	return "url:" + hex.EncodeToString(sum[:6])
+}
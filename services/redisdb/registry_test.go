@@ -0,0 +1,116 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type mapConfig map[string]any
+
+func (m mapConfig) GetValue(key string) (any, error) {
+	value, ok := m[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func TestLoadRedisConfig(t *testing.T) {
+	config, err := LoadRedisConfig(mapConfig{
+		"CACHE_URL":            "redis://localhost:6379/1",
+		"CACHE_POOL_SIZE":      "20",
+		"CACHE_READ_TIMEOUT":   "500ms",
+		"CACHE_SLOW_THRESHOLD": 2,
+	}, "CACHE")
+	if err != nil {
+		t.Fatalf("LoadRedisConfig: %v", err)
+	}
+	if config.URL != "redis://localhost:6379/1" || config.PoolSize != 20 ||
+		config.ReadTimeout != 500*time.Millisecond || config.SlowThreshold != 2*time.Second {
+		t.Fatalf("LoadRedisConfig() = %+v", config)
+	}
+	if _, err := LoadRedisConfig(mapConfig{}, "CACHE"); err == nil {
+		t.Fatalf("LoadRedisConfig() without URL succeeded")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	t.Cleanup(func() {
+		ClearCommandHooks()
+		_ = CloseAll()
+	})
+	metrics := NewMetricsHook()
+	RegisterCommandHook(metrics)
+
+	if _, err := ClientFor("sessions"); !errors.Is(err, ErrRedisNotInitialized) {
+		t.Fatalf("ClientFor() before init = %v, want ErrRedisNotInitialized", err)
+	}
+	if err := InitWithConfig(ctx, "sessions", RedisConfig{URL: "redis://" + server.Addr() + "/0", PoolSize: 3}); err != nil {
+		t.Fatalf("InitWithConfig: %v", err)
+	}
+	client, err := ClientFor("sessions")
+	if err != nil {
+		t.Fatalf("ClientFor: %v", err)
+	}
+	// 只统计连接建立之后的调用
+	metrics.Reset()
+	if err := client.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := client.Get(ctx, "missing").Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("Get(missing) = %v", err)
+	}
+	if _, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, "n")
+		pipe.Incr(ctx, "n")
+		return nil
+	}); err != nil {
+		t.Fatalf("Pipelined: %v", err)
+	}
+
+	snapshot := metrics.Snapshot()
+	// set、get和一次管道调用，redis.Nil不计为错误
+	if total := snapshot.Clients["sessions"]; total.Count != 3 || total.Errors != 0 {
+		t.Fatalf("client metrics = %+v", total)
+	}
+	commands := map[string]int64{}
+	for _, v := range snapshot.Commands {
+		commands[v.Command] = v.Count
+	}
+	if commands["set"] != 1 || commands["get"] != 1 || commands[CommandPipeline] != 1 {
+		t.Fatalf("command metrics = %v", commands)
+	}
+
+	if err := HealthCheck(ctx)["sessions"]; err != nil {
+		t.Fatalf("HealthCheck: %v", err)
+	}
+	if stats, err := StatsFor("sessions"); err != nil || stats.TotalConns == 0 {
+		t.Fatalf("StatsFor() = %+v, %v", stats, err)
+	}
+
+	if err := CloseFor("sessions"); err != nil {
+		t.Fatalf("CloseFor: %v", err)
+	}
+	if err := client.Ping(ctx).Err(); !errors.Is(err, redis.ErrClosed) {
+		t.Fatalf("Ping() after CloseFor = %v, want ErrClosed", err)
+	}
+	if _, err := ClientFor("sessions"); !errors.Is(err, ErrRedisNotInitialized) {
+		t.Fatalf("ClientFor() after CloseFor = %v, want ErrRedisNotInitialized", err)
+	}
+
+	addr := server.Addr()
+	server.Close()
+	if err := InitFor(ctx, "offline", "redis://"+addr+"/0"); err == nil {
+		t.Fatalf("InitFor() with unreachable server succeeded")
+	}
+	if _, err := ClientFor("offline"); !errors.Is(err, ErrRedisNotInitialized) {
+		t.Fatalf("failed client was registered: %v", err)
+	}
+}